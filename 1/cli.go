@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	exitOK     = 0
+	exitError  = 1 // ошибка при обходе или записи результата
+	exitUsage  = 2 // неверные аргументы
+	exitSource = 3 // не удалось открыть один из корней
+)
+
+const usageHeader = `usage: tree [flags] [path ...]
+
+Prints the tree of each path: a directory, a .zip or a .tar.gz archive.
+Flags may be given before or after paths.
+
+usage: tree --diff [flags] old new
+
+Prints one merged tree of old and new, marking added (+), removed (-)
+and changed (~) entries. old and new may be snapshots saved with -J.
+
+`
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// colorMode - значение --color: always, auto или never
+type colorMode string
+
+func (m *colorMode) String() string {
+	return string(*m)
+}
+
+func (m *colorMode) Set(value string) error {
+	switch value {
+	case "always", "auto", "never":
+		*m = colorMode(value)
+	default:
+		return fmt.Errorf("must be always, auto or never")
+	}
+	return nil
+}
+
+// cliFlags - флаги, которые превращаются в options только после разбора
+type cliFlags struct {
+	human bool
+	si    bool
+	json  bool
+	xml   bool
+	diff  bool
+	color colorMode
+}
+
+func (c cliFlags) apply(opts *options) {
+	if c.human {
+		opts.sizeUnits = unitsIEC
+	}
+	if c.si {
+		opts.sizeUnits = unitsSI
+	}
+	if c.json {
+		opts.format = formatJSON
+	}
+	if c.xml {
+		opts.format = formatXML
+	}
+}
+
+func newFlagSet(opts *options, cli *cliFlags, stderr io.Writer) *flag.FlagSet {
+	fl := flag.NewFlagSet("tree", flag.ContinueOnError)
+	fl.SetOutput(stderr)
+	// справку печатает run: на stdout для --help и на stderr при ошибке
+	fl.Usage = func() {}
+
+	fl.BoolVar(&opts.printFiles, "f", false, "print files, not only directories")
+	fl.Var((*stringList)(&opts.exclude), "I", "do not list entries matching the glob `pattern` (repeatable)")
+	fl.Var((*stringList)(&opts.include), "P", "list only files matching the glob `pattern` (repeatable)")
+	fl.BoolVar(&opts.gitignore, "gitignore", false, "honour .gitignore files")
+	fl.IntVar(&opts.maxDepth, "L", 0, "descend at most `level` directories deep")
+	fl.BoolVar(&opts.summary, "summary", false, "print the number of directories and files")
+	fl.BoolVar(&opts.du, "du", false, "print cumulative size of each directory")
+	fl.IntVar(&opts.workers, "j", 1, "read directories with `n` workers")
+	fl.BoolVar(&opts.followLinks, "l", false, "follow symbolic links to directories")
+	fl.StringVar(&opts.sortBy, "sort", sortName, "sort by `order`: name, size, mtime or ext")
+	fl.BoolVar(&opts.dirsFirst, "dirsfirst", false, "list directories before files")
+	fl.BoolVar(&opts.reverse, "r", false, "reverse the sort order")
+	fl.BoolVar(&opts.showPerm, "p", false, "print permissions")
+	fl.BoolVar(&opts.showTime, "D", false, "print modification time")
+	fl.BoolVar(&cli.human, "h", false, "print sizes in powers of 1024 (KiB, MiB)")
+	fl.BoolVar(&cli.si, "si", false, "print sizes in powers of 1000 (kB, MB)")
+	fl.BoolVar(&cli.json, "J", false, "print the tree as JSON")
+	fl.BoolVar(&cli.xml, "X", false, "print the tree as XML")
+	fl.StringVar(&opts.hash, "hash", "", "print a content digest of each file: `algo` is sha256 or xxhash")
+	fl.BoolVar(&opts.dupes, "dupes", false, "instead of the tree, list groups of identical files")
+	fl.BoolVar(&cli.diff, "diff", false, "compare two paths, either may be a snapshot saved with -J")
+	fl.Var(&cli.color, "color", "colorize names `when`: always, auto or never, colors are taken from LS_COLORS")
+
+	return fl
+}
+
+func printUsage(fl *flag.FlagSet, w io.Writer) {
+	fmt.Fprint(w, usageHeader)
+	fl.SetOutput(w)
+	fl.PrintDefaults()
+}
+
+// parseArgs разбирает флаги вперемешку с путями, как это принято у tree
+func parseArgs(fl *flag.FlagSet, args []string) ([]string, error) {
+	var roots []string
+	for {
+		if err := fl.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fl.Args()
+		if len(args) == 0 {
+			return roots, nil
+		}
+		roots = append(roots, args[0])
+		args = args[1:]
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	opts := options{}
+	cli := cliFlags{color: "never"}
+	fl := newFlagSet(&opts, &cli, stderr)
+
+	roots, err := parseArgs(fl, args)
+	if errors.Is(err, flag.ErrHelp) {
+		printUsage(fl, stdout)
+		return exitOK
+	}
+	if err != nil {
+		printUsage(fl, stderr)
+		return exitUsage
+	}
+	if opts.maxDepth < 0 || opts.workers < 1 || !validSort(opts.sortBy) {
+		fmt.Fprintln(stderr, "tree: -L must be >= 0, -j must be >= 1, --sort must be name, size, mtime or ext")
+		printUsage(fl, stderr)
+		return exitUsage
+	}
+
+	cli.apply(&opts)
+	if cli.diff && len(roots) != 2 {
+		fmt.Fprintln(stderr, "tree: --diff needs exactly two paths")
+		printUsage(fl, stderr)
+		return exitUsage
+	}
+
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	opts.rootNames = len(roots) > 1
+
+	out, isFile := stdout.(*os.File)
+	if cli.color == "always" || cli.color == "auto" && isFile && isTerminal(out) && os.Getenv("NO_COLOR") == "" {
+		opts.colors = parseLSColors(os.Getenv("LS_COLORS"))
+	}
+
+	if cli.diff {
+		return runDiff(roots[0], roots[1], stdout, stderr, opts)
+	}
+
+	code := exitOK
+	var sources []source
+	for _, root := range roots {
+		fsys, closeSource, err := openSource(root, opts.hash != "" || opts.dupes)
+		if err != nil {
+			fmt.Fprintln(stderr, "tree:", err)
+			code = exitSource
+			continue
+		}
+		defer closeSource()
+		sources = append(sources, source{name: root, fsys: fsys})
+	}
+	if len(sources) == 0 {
+		return code
+	}
+
+	if err := dirTreeSources(stdout, sources, opts); err != nil {
+		fmt.Fprintln(stderr, "tree:", err)
+		return exitError
+	}
+	return code
+}
+
+func runDiff(oldName, curName string, stdout, stderr io.Writer, opts options) int {
+	old, err := openSnapshot(oldName, opts)
+	if err != nil {
+		fmt.Fprintln(stderr, "tree:", err)
+		return exitSource
+	}
+	cur, err := openSnapshot(curName, opts)
+	if err != nil {
+		fmt.Fprintln(stderr, "tree:", err)
+		return exitSource
+	}
+
+	if err := dirTreeDiff(stdout, old, cur, opts); err != nil {
+		fmt.Fprintln(stderr, "tree:", err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+const defaultLSColors = "di=01;34:ln=01;36:or=40;31;01:ex=01;32"
+
+// palette - раскраска имён в стиле ls --color, настраивается через LS_COLORS
+type palette struct {
+	kinds map[string]string
+	exts  map[string]string
+}
+
+func parseLSColors(spec string) *palette {
+	p := &palette{kinds: map[string]string{}, exts: map[string]string{}}
+	for _, part := range strings.Split(defaultLSColors+":"+spec, ":") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[1] == "" || kv[1] == "target" {
+			continue
+		}
+		if strings.HasPrefix(kv[0], "*") {
+			p.exts[kv[0][1:]] = kv[1]
+		} else {
+			p.kinds[kv[0]] = kv[1]
+		}
+	}
+	return p
+}
+
+func (p *palette) code(n node) string {
+	switch {
+	case n.err == errBrokenLink && p.kinds["or"] != "":
+		return p.kinds["or"]
+	case n.target != "":
+		return p.kinds["ln"]
+	case n.IsDir():
+		return p.kinds["di"]
+	}
+
+	if info, err := n.Info(); err == nil && info.Mode()&0111 != 0 {
+		return p.kinds["ex"]
+	}
+
+	name := n.Name()
+	for i := 0; i < len(name); i++ {
+		if name[i] != '.' {
+			continue
+		}
+		if code, ok := p.exts[name[i:]]; ok {
+			return code
+		}
+	}
+	return p.kinds["fi"]
+}
+
+func (p *palette) paint(n node, text string) string {
+	if p == nil {
+		return text
+	}
+	code := p.code(n)
+	if code == "" {
+		return text
+	}
+	return "\x1b[" + code + "m" + text + "\x1b[0m"
+}
+
+// isTerminal - вывод в терминал, а не в файл или пайп
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	statusSame    = "same"
+	statusAdded   = "added"
+	statusRemoved = "removed"
+	statusChanged = "changed"
+)
+
+// snapNode - элемент дерева в памяти, совпадает по форме с выводом -J
+type snapNode struct {
+	Type     string      `json:"type"`
+	Name     string      `json:"name"`
+	Size     *int64      `json:"size,omitempty"`
+	Contents []*snapNode `json:"contents,omitempty"`
+}
+
+func (s *snapNode) isDir() bool {
+	return s.Type == "directory" || s.Contents != nil
+}
+
+// snapshotRenderer собирает обход в память: для сравнения нужны оба дерева целиком
+type snapshotRenderer struct {
+	roots []*snapNode
+	stack []*snapNode
+	last  *snapNode
+}
+
+func newSnapNode(name string, n node) (*snapNode, error) {
+	sn := &snapNode{Type: nodeType(n), Name: name}
+	if n.IsDir() {
+		sn.Type = "directory"
+		sn.Contents = []*snapNode{}
+		return sn, nil
+	}
+	info, err := n.Info()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	sn.Size = &size
+	return sn, nil
+}
+
+func (r *snapshotRenderer) root(name string, n node) error {
+	sn, err := newSnapNode(name, n)
+	if err != nil {
+		return err
+	}
+	r.roots = append(r.roots, sn)
+	r.last = sn
+	return nil
+}
+
+func (r *snapshotRenderer) entry(n node, last bool) error {
+	sn, err := newSnapNode(n.Name(), n)
+	if err != nil {
+		return err
+	}
+	parent := r.stack[len(r.stack)-1]
+	parent.Contents = append(parent.Contents, sn)
+	r.last = sn
+	return nil
+}
+
+func (r *snapshotRenderer) enter() error {
+	r.stack = append(r.stack, r.last)
+	return nil
+}
+
+func (r *snapshotRenderer) leave() error {
+	r.stack = r.stack[:len(r.stack)-1]
+	return nil
+}
+
+func (r *snapshotRenderer) close(sum *summary) error {
+	return nil
+}
+
+// snapshotSource собирает дерево src; файлы берутся всегда, без них нечего сравнивать
+func snapshotSource(src source, opts options) (*snapNode, error) {
+	opts.printFiles = true
+	render := &snapshotRenderer{}
+	if err := walkSource(render, src, opts, &summary{}); err != nil {
+		return nil, err
+	}
+	return render.roots[0], nil
+}
+
+// loadSnapshot читает сохранённый вывод -J, берётся первый корень
+func loadSnapshot(r io.Reader) (*snapNode, error) {
+	var nodes []*snapNode
+	if err := json.NewDecoder(r).Decode(&nodes); err != nil {
+		return nil, err
+	}
+	for _, sn := range nodes {
+		if sn.isDir() {
+			return sn, nil
+		}
+	}
+	return nil, errors.New("snapshot has no root directory")
+}
+
+// openSnapshot - сохранённый .json снимок или дерево каталога/архива
+func openSnapshot(name string, opts options) (*snapNode, error) {
+	if strings.HasSuffix(strings.ToLower(name), ".json") {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return loadSnapshot(file)
+	}
+
+	fsys, closeSource, err := openSource(name, false)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSource()
+	return snapshotSource(source{name: name, fsys: fsys}, opts)
+}
+
+type diffNode struct {
+	Type     string      `json:"type"`
+	Name     string      `json:"name"`
+	Status   string      `json:"status"`
+	Size     *int64      `json:"size,omitempty"`
+	OldSize  *int64      `json:"old_size,omitempty"`
+	Contents []*diffNode `json:"contents,omitempty"`
+}
+
+func sortedContents(sn *snapNode) []*snapNode {
+	if sn == nil || !sn.isDir() {
+		return nil
+	}
+	list := append([]*snapNode(nil), sn.Contents...)
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// mark переносит поддерево целиком как добавленное или удалённое
+func mark(sn *snapNode, status string) *diffNode {
+	d := &diffNode{Type: sn.Type, Name: sn.Name, Status: status}
+	if status == statusRemoved {
+		d.OldSize = sn.Size
+	} else {
+		d.Size = sn.Size
+	}
+	for _, child := range sortedContents(sn) {
+		d.Contents = append(d.Contents, mark(child, status))
+	}
+	return d
+}
+
+func sameSize(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// diffSnapshots сливает два дерева; каталог помечается changed, если изменилось что-то внутри
+func diffSnapshots(old, cur *snapNode) *diffNode {
+	d := &diffNode{Type: cur.Type, Name: cur.Name, Status: statusSame, Size: cur.Size}
+	if old.isDir() != cur.isDir() || !cur.isDir() && !sameSize(old.Size, cur.Size) {
+		d.Status = statusChanged
+		d.OldSize = old.Size
+	}
+	if !cur.isDir() {
+		return d
+	}
+
+	oldList, curList := sortedContents(old), sortedContents(cur)
+	i, j := 0, 0
+	for i < len(oldList) || j < len(curList) {
+		var child *diffNode
+		switch {
+		case j == len(curList) || i < len(oldList) && oldList[i].Name < curList[j].Name:
+			child = mark(oldList[i], statusRemoved)
+			i++
+		case i == len(oldList) || curList[j].Name < oldList[i].Name:
+			child = mark(curList[j], statusAdded)
+			j++
+		default:
+			child = diffSnapshots(oldList[i], curList[j])
+			i++
+			j++
+		}
+		if child.Status != statusSame {
+			d.Status = statusChanged
+		}
+		d.Contents = append(d.Contents, child)
+	}
+	return d
+}
+
+var diffMarks = map[string]struct {
+	sign  string
+	color string
+}{
+	statusSame:    {"", ""},
+	statusAdded:   {"+ ", "32"},
+	statusRemoved: {"- ", "31"},
+	statusChanged: {"~ ", "33"},
+}
+
+func diffSize(d *diffNode, units string) string {
+	switch {
+	case d.Size != nil && d.OldSize != nil:
+		return " (" + formatSize(*d.OldSize, units) + " -> " + formatSize(*d.Size, units) + ")"
+	case d.Size != nil:
+		return " (" + formatSize(*d.Size, units) + ")"
+	case d.OldSize != nil:
+		return " (" + formatSize(*d.OldSize, units) + ")"
+	}
+	return ""
+}
+
+func writeDiffText(out io.Writer, active []bool, list []*diffNode, opts options) error {
+	for idx, d := range list {
+		last := idx == len(list)-1
+		writePrefix(active, out)
+		out.Write(Out(!last))
+
+		line := diffMarks[d.Status].sign + d.Name
+		if opts.colors != nil && d.Status != statusSame {
+			line = "\x1b[" + diffMarks[d.Status].color + "m" + line + "\x1b[0m"
+		}
+		if _, err := io.WriteString(out, line+diffSize(d, opts.sizeUnits)+"\n"); err != nil {
+			return err
+		}
+
+		if err := writeDiffText(out, append(active, !last), d.Contents, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirTreeDiff выводит общее дерево двух снимков с отметками изменений
+func dirTreeDiff(out io.Writer, old, cur *snapNode, opts options) error {
+	root := diffSnapshots(old, cur)
+	switch opts.format {
+	case "", formatText:
+		return writeDiffText(out, []bool{}, root.Contents, opts)
+	case formatJSON:
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode([]*diffNode{root})
+	}
+	return fmt.Errorf("diff does not support %q output", opts.format)
+}
+
+func dirTreeDiffFS(out io.Writer, old, cur fs.FS, opts options) error {
+	oldSnap, err := snapshotSource(source{name: ".", fsys: old}, opts)
+	if err != nil {
+		return err
+	}
+	curSnap, err := snapshotSource(source{name: ".", fsys: cur}, opts)
+	if err != nil {
+		return err
+	}
+	return dirTreeDiff(out, oldSnap, curSnap, opts)
+}
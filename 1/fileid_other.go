@@ -0,0 +1,11 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package main
+
+import "os"
+
+// на остальных системах нет device/inode, каталоги сравниваются по пути, см. walker.identity
+func fileIdentity(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
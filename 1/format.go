@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatXML  = "xml"
+)
+
+// renderer получает обход в порядке вывода: после root и после entry для
+// каталога всегда идут enter, его содержимое и leave. Корней может быть несколько
+type renderer interface {
+	root(name string, n node) error
+	entry(n node, last bool) error
+	enter() error
+	leave() error
+	close(sum *summary) error
+}
+
+func newRenderer(out io.Writer, opts options) (renderer, error) {
+	if opts.dupes {
+		return &dupesRenderer{out: out, opts: opts, groups: map[string][]dupeFile{}}, nil
+	}
+	switch opts.format {
+	case "", formatText:
+		return &textRenderer{out: out, opts: opts}, nil
+	case formatJSON:
+		return &jsonRenderer{out: out, hash: opts.hash}, nil
+	case formatXML:
+		return &xmlRenderer{out: out, enc: xml.NewEncoder(out), hash: opts.hash}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", opts.format)
+}
+
+type textRenderer struct {
+	out    io.Writer
+	opts   options
+	active []bool
+	last   bool
+}
+
+func (r *textRenderer) root(name string, n node) error {
+	r.last = true
+	if !r.opts.rootNames {
+		return nil
+	}
+	_, err := io.WriteString(r.out, r.opts.colors.paint(n, name)+"\n")
+	return err
+}
+
+// entry - первый уровень active относится к корню и в отступ не попадает
+func (r *textRenderer) entry(n node, last bool) error {
+	writePrefix(r.active[1:], r.out)
+	r.out.Write(Out(!last))
+	if r.opts.showPerm || r.opts.showTime {
+		r.out.Write(r.columns(n))
+	}
+	r.out.Write([]byte(r.opts.colors.paint(n, n.Name())))
+	if n.target != "" {
+		r.out.Write([]byte(" -> " + n.target))
+	}
+	r.out.Write(printSize(r.opts.printFiles, n, r.opts.sizeUnits))
+	if n.du >= 0 {
+		r.out.Write([]byte(" (" + formatSize(n.du, r.opts.sizeUnits) + ")"))
+	}
+	if n.digest != "" {
+		r.out.Write([]byte(" " + r.opts.hash + ":" + n.digest))
+	}
+	if n.err != nil {
+		r.out.Write([]byte(" [" + errText(n.err) + "]"))
+	}
+	_, err := r.out.Write([]byte("\n"))
+	r.last = last
+	return err
+}
+
+// columns - права и время изменения в квадратных скобках перед именем, как у tree -p -D
+func (r *textRenderer) columns(n node) []byte {
+	var cols []string
+	info, err := n.Info()
+	if err != nil {
+		return []byte("[?] ")
+	}
+	if r.opts.showPerm {
+		cols = append(cols, info.Mode().String())
+	}
+	if r.opts.showTime {
+		cols = append(cols, info.ModTime().Format("2006-01-02 15:04"))
+	}
+	return []byte("[" + strings.Join(cols, " ") + "] ")
+}
+
+func (r *textRenderer) enter() error {
+	r.active = append(r.active, !r.last)
+	return nil
+}
+
+func (r *textRenderer) leave() error {
+	r.active = r.active[:len(r.active)-1]
+	return nil
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return strconv.Itoa(n) + " " + many
+}
+
+func (r *textRenderer) close(sum *summary) error {
+	if sum == nil {
+		return nil
+	}
+	report := "\n" + plural(sum.dirs, "directory", "directories")
+	if r.opts.printFiles {
+		report += ", " + plural(sum.files, "file", "files")
+	}
+	_, err := io.WriteString(r.out, report+"\n")
+	return err
+}
+
+func nodeType(n node) string {
+	if n.target != "" {
+		return "link"
+	}
+	if n.IsDir() {
+		return "directory"
+	}
+	return "file"
+}
+
+// nodeSize - размер файла или, в режиме --du, суммарный размер каталога
+func nodeSize(n node, info os.FileInfo) (int64, bool) {
+	if !n.IsDir() {
+		return info.Size(), true
+	}
+	return n.du, n.du >= 0
+}
+
+type jsonRenderer struct {
+	out   io.Writer
+	hash  string
+	first []bool
+}
+
+func (r *jsonRenderer) node(name string, n node) error {
+	info, err := n.Info()
+	if err != nil {
+		return err
+	}
+	quoted, _ := json.Marshal(name)
+
+	fields := []string{
+		`"type":"` + nodeType(n) + `"`,
+		`"name":` + string(quoted),
+	}
+	if n.target != "" {
+		quoted, _ = json.Marshal(n.target)
+		fields = append(fields, `"target":`+string(quoted))
+	}
+	if size, ok := nodeSize(n, info); ok {
+		fields = append(fields, `"size":`+strconv.FormatInt(size, 10))
+	}
+	fields = append(fields,
+		`"mode":"`+info.Mode().String()+`"`,
+		`"mtime":"`+info.ModTime().Format(time.RFC3339)+`"`,
+	)
+	if n.digest != "" {
+		fields = append(fields, `"`+r.hash+`":"`+n.digest+`"`)
+	}
+	if n.err != nil {
+		quoted, _ = json.Marshal(errText(n.err))
+		fields = append(fields, `"error":`+string(quoted))
+	}
+
+	line := "{" + strings.Join(fields, ",")
+	if n.IsDir() {
+		line += `,"contents":[`
+	} else {
+		line += "}"
+	}
+
+	depth := len(r.first)
+	sep := "\n"
+	if !r.first[depth-1] {
+		sep = ",\n"
+	}
+	r.first[depth-1] = false
+
+	_, err = io.WriteString(r.out, sep+strings.Repeat("  ", depth)+line)
+	return err
+}
+
+func (r *jsonRenderer) start() error {
+	if r.first != nil {
+		return nil
+	}
+	r.first = []bool{true}
+	_, err := io.WriteString(r.out, "[")
+	return err
+}
+
+func (r *jsonRenderer) root(name string, n node) error {
+	if err := r.start(); err != nil {
+		return err
+	}
+	return r.node(name, n)
+}
+
+func (r *jsonRenderer) entry(n node, last bool) error {
+	return r.node(n.Name(), n)
+}
+
+func (r *jsonRenderer) enter() error {
+	r.first = append(r.first, true)
+	return nil
+}
+
+func (r *jsonRenderer) leave() error {
+	r.first = r.first[:len(r.first)-1]
+	_, err := io.WriteString(r.out, "\n"+strings.Repeat("  ", len(r.first))+"]}")
+	return err
+}
+
+func (r *jsonRenderer) close(sum *summary) error {
+	if err := r.start(); err != nil {
+		return err
+	}
+	if sum != nil {
+		sep := ",\n  "
+		if r.first[0] {
+			sep = "\n  "
+		}
+		report := fmt.Sprintf(`{"type":"report","directories":%d,"files":%d}`, sum.dirs, sum.files)
+		if _, err := io.WriteString(r.out, sep+report); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(r.out, "\n]\n")
+	return err
+}
+
+type xmlRenderer struct {
+	out   io.Writer
+	enc   *xml.Encoder
+	hash  string
+	names []string
+}
+
+func (r *xmlRenderer) node(name string, n node) error {
+	info, err := n.Info()
+	if err != nil {
+		return err
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: nodeType(n)}}
+	start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "name"}, Value: name})
+	if n.target != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "target"}, Value: n.target})
+	}
+	if size, ok := nodeSize(n, info); ok {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "size"}, Value: strconv.FormatInt(size, 10)})
+	}
+	start.Attr = append(start.Attr,
+		xml.Attr{Name: xml.Name{Local: "mode"}, Value: info.Mode().String()},
+		xml.Attr{Name: xml.Name{Local: "mtime"}, Value: info.ModTime().Format(time.RFC3339)},
+	)
+	if n.digest != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: r.hash}, Value: n.digest})
+	}
+	if n.err != nil {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "error"}, Value: errText(n.err)})
+	}
+
+	if err := r.enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if !n.IsDir() {
+		return r.enc.EncodeToken(start.End())
+	}
+	r.names = append(r.names, start.Name.Local)
+	return nil
+}
+
+func (r *xmlRenderer) start() error {
+	if r.names != nil {
+		return nil
+	}
+	r.enc.Indent("", "  ")
+	if _, err := io.WriteString(r.out, xml.Header); err != nil {
+		return err
+	}
+	r.names = []string{"tree"}
+	return r.enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "tree"}})
+}
+
+func (r *xmlRenderer) root(name string, n node) error {
+	if err := r.start(); err != nil {
+		return err
+	}
+	return r.node(name, n)
+}
+
+func (r *xmlRenderer) entry(n node, last bool) error {
+	return r.node(n.Name(), n)
+}
+
+func (r *xmlRenderer) enter() error {
+	return r.enc.Flush()
+}
+
+func (r *xmlRenderer) leave() error {
+	name := r.names[len(r.names)-1]
+	r.names = r.names[:len(r.names)-1]
+	return r.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}})
+}
+
+func (r *xmlRenderer) close(sum *summary) error {
+	if err := r.start(); err != nil {
+		return err
+	}
+	if sum != nil {
+		report := struct {
+			XMLName     xml.Name `xml:"report"`
+			Directories int      `xml:"directories"`
+			Files       int      `xml:"files"`
+		}{Directories: sum.dirs, Files: sum.files}
+		if err := r.enc.Encode(report); err != nil {
+			return err
+		}
+	}
+	if err := r.leave(); err != nil {
+		return err
+	}
+	if err := r.enc.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(r.out, "\n")
+	return err
+}
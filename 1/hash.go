@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	hashSHA256 = "sha256"
+	hashXX     = "xxhash"
+)
+
+func newHash(algo string) (func() hash.Hash, error) {
+	switch algo {
+	case hashSHA256:
+		return sha256.New, nil
+	case hashXX:
+		return func() hash.Hash { return xxhash.New() }, nil
+	}
+	return nil, fmt.Errorf("unknown hash %q, must be sha256 or xxhash", algo)
+}
+
+func hashFile(fsys fs.FS, name string, newHash func() hash.Hash) (string, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := newHash()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashWorkers - хешированию нужен процессор, поэтому пул не меньше числа ядер
+func hashWorkers(opts options) int {
+	if opts.workers > runtime.NumCPU() {
+		return opts.workers
+	}
+	return runtime.NumCPU()
+}
+
+type dupeFile struct {
+	path string
+	size int64
+}
+
+// dupesRenderer вместо дерева собирает файлы по хешу и в конце печатает группы совпадающих
+type dupesRenderer struct {
+	out    io.Writer
+	opts   options
+	dirs   []string
+	last   string
+	groups map[string][]dupeFile
+}
+
+func (r *dupesRenderer) root(name string, n node) error {
+	r.last = name
+	return nil
+}
+
+func (r *dupesRenderer) entry(n node, last bool) error {
+	full := r.dirs[len(r.dirs)-1] + "/" + n.Name()
+	r.last = full
+	if n.IsDir() || n.digest == "" {
+		return nil
+	}
+	info, err := n.Info()
+	if err != nil || info.Size() == 0 {
+		return nil
+	}
+	r.groups[n.digest] = append(r.groups[n.digest], dupeFile{path: full, size: info.Size()})
+	return nil
+}
+
+func (r *dupesRenderer) enter() error {
+	r.dirs = append(r.dirs, r.last)
+	return nil
+}
+
+func (r *dupesRenderer) leave() error {
+	r.dirs = r.dirs[:len(r.dirs)-1]
+	return nil
+}
+
+type dupeGroup struct {
+	Digest string   `json:"digest"`
+	Size   int64    `json:"size"`
+	Files  []string `json:"files"`
+}
+
+// close печатает группы от самых больших файлов к меньшим, пустые файлы не считаются
+func (r *dupesRenderer) close(sum *summary) error {
+	var groups []dupeGroup
+	for digest, files := range r.groups {
+		if len(files) < 2 {
+			continue
+		}
+		g := dupeGroup{Digest: digest, Size: files[0].size}
+		for _, f := range files {
+			g.Files = append(g.Files, f.path)
+		}
+		sort.Strings(g.Files)
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Size != groups[j].Size {
+			return groups[i].Size > groups[j].Size
+		}
+		return groups[i].Digest < groups[j].Digest
+	})
+
+	if r.opts.format == formatJSON {
+		if groups == nil {
+			groups = []dupeGroup{}
+		}
+		enc := json.NewEncoder(r.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(groups)
+	}
+
+	for i, g := range groups {
+		sep := "\n"
+		if i == 0 {
+			sep = ""
+		}
+		header := fmt.Sprintf("%s%s, %d files, %s:%s\n", sep, formatSize(g.Size, r.opts.sizeUnits), len(g.Files), r.opts.hash, g.Digest)
+		if _, err := io.WriteString(r.out, header+"\t"+strings.Join(g.Files, "\n\t")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreList - правила одного .gitignore, parent указывает на файл уровнем выше
+type ignoreList struct {
+	parent *ignoreList
+	base   string
+	rules  []ignoreRule
+}
+
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || line[0] == '#' {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{}
+	if line[0] == '!' {
+		rule.negate = true
+		line = line[1:]
+	} else if line[0] == '\\' {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	rule.segments = strings.Split(line, "/")
+	return rule, true
+}
+
+func readIgnoreFile(fsys fs.FS, parent *ignoreList, dir string) (*ignoreList, error) {
+	file, err := fsys.Open(path.Join(dir, ".gitignore"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return parent, nil
+	}
+	if err != nil {
+		return parent, err
+	}
+	defer file.Close()
+
+	list := &ignoreList{parent: parent, base: dir}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+			list.rules = append(list.rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return parent, err
+	}
+
+	if len(list.rules) == 0 {
+		return parent, nil
+	}
+	return list, nil
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return len(name) > 0
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+func (rule ignoreRule) match(rel string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	if !rule.anchored {
+		ok, _ := path.Match(rule.segments[0], path.Base(rel))
+		return ok
+	}
+	return matchSegments(rule.segments, strings.Split(rel, "/"))
+}
+
+// ignored - более глубокие .gitignore и более поздние правила имеют приоритет, как в git
+func (list *ignoreList) ignored(rel string, isDir bool) bool {
+	for cur := list; cur != nil; cur = cur.parent {
+		local := rel
+		if cur.base != "." {
+			local = strings.TrimPrefix(rel, cur.base+"/")
+		}
+		for i := len(cur.rules) - 1; i >= 0; i-- {
+			if cur.rules[i].match(local, isDir) {
+				return !cur.rules[i].negate
+			}
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+var errLookaheadStopped = errors.New("lookahead stopped")
+
+type pending struct {
+	path   string
+	result interface{}
+	err    error
+	done   chan struct{}
+}
+
+// lookahead выполняет work для путей заранее пулом из workers горутин.
+// Обход забирает результаты в своём порядке, поэтому вывод не меняется
+type lookahead struct {
+	work    func(path string) (interface{}, error)
+	jobs    chan *pending
+	quit    chan struct{}
+	mu      sync.Mutex
+	pending map[string]*pending
+	wg      sync.WaitGroup
+}
+
+func newLookahead(workers int, work func(path string) (interface{}, error)) *lookahead {
+	p := &lookahead{
+		work:    work,
+		jobs:    make(chan *pending, workers*4),
+		quit:    make(chan struct{}),
+		pending: make(map[string]*pending),
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.run()
+	}
+	return p
+}
+
+func (p *lookahead) run() {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		select {
+		case <-p.quit:
+			job.err = errLookaheadStopped
+		default:
+			job.result, job.err = p.work(job.path)
+		}
+		close(job.done)
+	}
+}
+
+// schedule ставит путь в очередь, блокируется если очередь заполнена
+func (p *lookahead) schedule(path string) {
+	job := &pending{path: path, done: make(chan struct{})}
+	p.mu.Lock()
+	p.pending[path] = job
+	p.mu.Unlock()
+	p.jobs <- job
+}
+
+// get ждёт заранее запрошенный результат, незапрошенный считает сразу
+func (p *lookahead) get(path string) (interface{}, error) {
+	p.mu.Lock()
+	job, ok := p.pending[path]
+	delete(p.pending, path)
+	p.mu.Unlock()
+
+	if !ok {
+		return p.work(path)
+	}
+	<-job.done
+	return job.result, job.err
+}
+
+func (p *lookahead) close() {
+	close(p.quit)
+	close(p.jobs)
+	p.wg.Wait()
+}
@@ -3,8 +3,8 @@ package main
 import (
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
-	"sort"
 )
 
 func writePrefix(active []bool, out io.Writer) error {
@@ -24,87 +24,171 @@ func Out(flag bool) []byte {
 	return []byte("└───")
 }
 
-func printSize(flag bool, entry os.DirEntry) []byte {
+const (
+	unitsIEC = "iec"
+	unitsSI  = "si"
+)
+
+func formatSize(sz int64, units string) string {
+	if sz == 0 {
+		return "empty"
+	}
+
+	base, suffixes := float64(1024), []string{"KiB", "MiB", "GiB", "TiB", "PiB"}
+	switch units {
+	case unitsIEC:
+	case unitsSI:
+		base, suffixes = 1000, []string{"kB", "MB", "GB", "TB", "PB"}
+	default:
+		return fmt.Sprint(sz) + "b"
+	}
+
+	if float64(sz) < base {
+		return fmt.Sprint(sz) + "B"
+	}
+	value, suffix := float64(sz)/base, suffixes[0]
+	for _, next := range suffixes[1:] {
+		if value < base {
+			break
+		}
+		value, suffix = value/base, next
+	}
+	return fmt.Sprintf("%.1f%s", value, suffix)
+}
+
+func printSize(flag bool, entry os.DirEntry, units string) []byte {
 	if !flag || entry.IsDir() {
 		return []byte{}
 	}
 	fileInfo, _ := entry.Info()
-	sz := fileInfo.Size()
 
-	add := fmt.Sprint(sz) + "b"
-	if sz == 0 {
-		add = "empty"
-	}
+	return []byte(" (" + formatSize(fileInfo.Size(), units) + ")")
+}
+
+type options struct {
+	printFiles  bool
+	exclude     []string
+	include     []string
+	gitignore   bool
+	format      string
+	maxDepth    int
+	summary     bool
+	du          bool
+	workers     int
+	followLinks bool
+	sortBy      string
+	dirsFirst   bool
+	reverse     bool
+	sizeUnits   string
+	showPerm    bool
+	showTime    bool
+	rootNames   bool
+	colors      *palette
+	hash        string
+	dupes       bool
+}
 
-	return []byte(" (" + add + ")")
+type source struct {
+	name string
+	fsys fs.FS
 }
 
-func dfsDirTree(active []bool, out io.Writer, path string, printFiles bool) error {
-	list, err := os.ReadDir(path)
+func walkSource(render renderer, src source, opts options, count *summary) error {
+	info, err := fs.Stat(src.fsys, ".")
 	if err != nil {
 		return err
 	}
 
-	var newList []os.DirEntry
-	for _, entry := range list {
-		if entry.IsDir() {
-			newList = append(newList, entry)
+	w := &walker{fsys: src.fsys, render: render, opts: opts, count: count, ancestors: make(map[fileID]bool)}
+	if opts.workers > 1 {
+		w.fetch = newLookahead(opts.workers, func(dir string) (interface{}, error) {
+			return w.listDir(dir)
+		})
+		defer w.fetch.close()
+	}
+	if opts.hash != "" {
+		newHash, err := newHash(opts.hash)
+		if err != nil {
+			return err
 		}
+		w.hashes = newLookahead(hashWorkers(opts), func(name string) (interface{}, error) {
+			return hashFile(src.fsys, name, newHash)
+		})
+		defer w.hashes.close()
 	}
 
-	if !printFiles {
-		list = newList
+	root := node{DirEntry: fs.FileInfoToDirEntry(info), dir: true, du: -1}
+	w.push(root, ".")
+	list, ignore, err := w.readDir(".", nil)
+	if err != nil {
+		return err
 	}
 
-	if len(list) == 0 {
-		return nil
+	if opts.du {
+		w.sizes = make(map[string]int64)
+		w.listings = make(map[string]listing)
+		root.du = w.duDirTree(".", list, ignore)
 	}
 
-	sort.Slice(list, func(i, j int) bool {
-		return list[i].Name() < list[j].Name()
-	})
-
-	flag := true
-
-	for idx, entry := range list {
-
-		writePrefix(active, out)
+	if err = render.root(src.name, root); err != nil {
+		return err
+	}
+	if err = render.enter(); err != nil {
+		return err
+	}
+	if err = w.dfsDirTree(".", 1, list, ignore); err != nil {
+		return err
+	}
+	return render.leave()
+}
 
-		if idx == len(list)-1 {
-			flag = false
+// dirTreeSources выводит деревья нескольких корней одним документом
+func dirTreeSources(out io.Writer, sources []source, opts options) error {
+	if !validSort(opts.sortBy) {
+		return fmt.Errorf("unknown sort order %q", opts.sortBy)
+	}
+	if opts.dupes {
+		opts.printFiles = true
+		if opts.hash == "" {
+			opts.hash = hashSHA256
 		}
+	}
+	if opts.hash != "" {
+		if _, err := newHash(opts.hash); err != nil {
+			return err
+		}
+	}
+	render, err := newRenderer(out, opts)
+	if err != nil {
+		return err
+	}
 
-		out.Write(Out(flag))
-
-		out.Write([]byte(entry.Name()))
+	count := &summary{}
+	for _, src := range sources {
+		if err = walkSource(render, src, opts, count); err != nil {
+			return err
+		}
+	}
 
-		out.Write(printSize(printFiles, entry))
+	if !opts.summary {
+		return render.close(nil)
+	}
+	return render.close(count)
+}
 
-		out.Write([]byte("\n"))
+// dirTreeFS выводит дерево произвольной файловой системы, name - подпись корня
+func dirTreeFS(out io.Writer, fsys fs.FS, name string, opts options) error {
+	return dirTreeSources(out, []source{{name: name, fsys: fsys}}, opts)
+}
 
-		if entry.IsDir() {
-			err = dfsDirTree(append(active, flag), out, path+string(os.PathSeparator)+entry.Name(), printFiles)
-			if err != nil {
-				return err
-			}
-		}
-	}
-	return nil
+func dirTreeOpts(out io.Writer, path string, opts options) error {
+	return dirTreeFS(out, newOSFS(path), path, opts)
 }
 
 func dirTree(out io.Writer, path string, printFiles bool) error {
-	return dfsDirTree([]bool{}, out, path, printFiles)
+	return dirTreeOpts(out, path, options{printFiles: printFiles})
 }
 
 func main() {
-	out := os.Stdout
-	if !(len(os.Args) == 2 || len(os.Args) == 3) {
-		panic("usage go run main.go . [-f]")
-	}
-	path := os.Args[1]
-	printFiles := len(os.Args) == 3 && os.Args[2] == "-f"
-	err := dirTree(out, path, printFiles)
-	if err != nil {
-		panic(err.Error())
-	}
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
 }
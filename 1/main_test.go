@@ -1,8 +1,25 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 const testFullResult = `├───project
@@ -73,3 +90,1025 @@ func TestTreeDir(t *testing.T) {
 		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testDirResult)
 	}
 }
+
+const testExcludeResult = `├───project
+│	└───file.txt (19b)
+├───static
+│	├───css
+│	│	└───body.css (28b)
+│	├───empty.txt (empty)
+│	├───html
+│	│	└───index.html (57b)
+│	└───js
+│		└───site.js (10b)
+└───zzfile.txt (empty)
+`
+
+func TestTreeExclude(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, "testdata", options{
+		printFiles: true,
+		exclude:    []string{"*_lorem", "*.png", "zline"},
+	})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testExcludeResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testExcludeResult)
+	}
+}
+
+const testIncludeResult = `├───project
+│	└───file.txt (19b)
+├───static
+│	├───a_lorem
+│	│	├───dolor.txt (empty)
+│	│	└───ipsum
+│	├───css
+│	├───empty.txt (empty)
+│	├───html
+│	├───js
+│	└───z_lorem
+│		├───dolor.txt (empty)
+│		└───ipsum
+├───zline
+│	├───empty.txt (empty)
+│	└───lorem
+│		├───dolor.txt (empty)
+│		└───ipsum
+└───zzfile.txt (empty)
+`
+
+func TestTreeInclude(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, "testdata", options{
+		printFiles: true,
+		include:    []string{"*.txt"},
+	})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testIncludeResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testIncludeResult)
+	}
+}
+
+const testGitignoreResult = `├───.gitignore (13b)
+├───main.go (empty)
+└───src
+	├───.gitignore (15b)
+	├───keep.log (empty)
+	└───lib
+		├───gen
+		│	└───keep.go (empty)
+		└───lib.go (empty)
+`
+
+func TestTreeGitignore(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":          "*.log\nbuild/\n",
+		".git/HEAD":           "",
+		"main.go":             "",
+		"build/out.bin":       "",
+		"debug.log":           "",
+		"src/.gitignore":      "!keep.log\n/gen\n",
+		"src/keep.log":        "",
+		"src/drop.log":        "",
+		"src/gen/gen.go":      "",
+		"src/lib/lib.go":      "",
+		"src/lib/gen/keep.go": "",
+	}
+	for name, content := range files {
+		full := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, root, options{printFiles: true, gitignore: true})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testGitignoreResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testGitignoreResult)
+	}
+}
+
+type testNode struct {
+	Type     string     `json:"type"`
+	Name     string     `json:"name" xml:"name,attr"`
+	Size     int64      `json:"size" xml:"size,attr"`
+	Contents []testNode `json:"contents"`
+	Dirs     []testNode `json:"-" xml:"directory"`
+	Files    []testNode `json:"-" xml:"file"`
+}
+
+// printTestNodes переводит разобранный документ обратно в текстовое дерево
+func printTestNodes(out *bytes.Buffer, prefix string, nodes []testNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	for i, node := range nodes {
+		last := i == len(nodes)-1
+		out.WriteString(prefix + string(Out(!last)) + node.Name)
+		if node.Type == "file" {
+			if node.Size == 0 {
+				out.WriteString(" (empty)")
+			} else {
+				fmt.Fprintf(out, " (%db)", node.Size)
+			}
+		}
+		out.WriteString("\n")
+
+		children := node.Contents
+		for _, dir := range node.Dirs {
+			dir.Type = "directory"
+			children = append(children, dir)
+		}
+		for _, file := range node.Files {
+			file.Type = "file"
+			children = append(children, file)
+		}
+		if last {
+			printTestNodes(out, prefix+"\t", children)
+		} else {
+			printTestNodes(out, prefix+"│\t", children)
+		}
+	}
+}
+
+func TestTreeJSON(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, "testdata", options{printFiles: true, format: formatJSON})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+
+	var nodes []testNode
+	if err := json.Unmarshal(out.Bytes(), &nodes); err != nil {
+		t.Fatalf("bad json: %v\n%s", err, out.String())
+	}
+	if len(nodes) != 1 || nodes[0].Name != "testdata" || nodes[0].Type != "directory" {
+		t.Fatalf("unexpected root: %+v", nodes)
+	}
+
+	result := new(bytes.Buffer)
+	printTestNodes(result, "", nodes[0].Contents)
+	if result.String() != testFullResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testFullResult)
+	}
+}
+
+func TestTreeXML(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, "testdata", options{printFiles: false, format: formatXML})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+
+	var doc struct {
+		Dirs []testNode `xml:"directory"`
+	}
+	if err := xml.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("bad xml: %v\n%s", err, out.String())
+	}
+	if len(doc.Dirs) != 1 || doc.Dirs[0].Name != "testdata" {
+		t.Fatalf("unexpected root: %+v", doc.Dirs)
+	}
+
+	result := new(bytes.Buffer)
+	printTestNodes(result, "", doc.Dirs[0].Dirs)
+	if result.String() != testDirResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testDirResult)
+	}
+}
+
+const testDepthResult = `├───project
+│	├───file.txt (19b)
+│	└───gopher.png (70372b)
+├───static
+│	├───a_lorem
+│	├───css
+│	├───empty.txt (empty)
+│	├───html
+│	├───js
+│	└───z_lorem
+├───zline
+│	├───empty.txt (empty)
+│	└───lorem
+└───zzfile.txt (empty)
+
+9 directories, 5 files
+`
+
+func TestTreeDepthSummary(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, "testdata", options{printFiles: true, maxDepth: 2, summary: true})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testDepthResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testDepthResult)
+	}
+}
+
+const testDuResult = `├───project (70391b)
+├───static (281583b)
+│	├───a_lorem (140744b)
+│	│	└───ipsum (70372b)
+│	├───css (28b)
+│	├───html (57b)
+│	├───js (10b)
+│	└───z_lorem (140744b)
+│		└───ipsum (70372b)
+└───zline (140744b)
+	└───lorem (140744b)
+		└───ipsum (70372b)
+
+12 directories
+`
+
+func TestTreeDu(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, "testdata", options{printFiles: false, du: true, summary: true})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testDuResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testDuResult)
+	}
+}
+
+// countingFS считает чтения каталогов
+type countingFS struct {
+	fs.FS
+	mu    sync.Mutex
+	reads map[string]int
+}
+
+func (c *countingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	c.mu.Lock()
+	c.reads[name]++
+	c.mu.Unlock()
+	return fs.ReadDir(c.FS, name)
+}
+
+func TestTreeDuReadsOnce(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		fsys := &countingFS{FS: newOSFS("testdata"), reads: map[string]int{}}
+		err := dirTreeFS(new(bytes.Buffer), fsys, "testdata", options{printFiles: true, du: true, workers: workers})
+		if err != nil {
+			t.Errorf("test for OK Failed - error")
+		}
+		if len(fsys.reads) != 13 {
+			t.Errorf("%d directories read, expected 13", len(fsys.reads))
+		}
+		for dir, n := range fsys.reads {
+			if n != 1 {
+				t.Errorf("workers %d: %s read %d times", workers, dir, n)
+			}
+		}
+	}
+}
+
+func TestTreeParallel(t *testing.T) {
+	cases := []options{
+		{printFiles: true},
+		{printFiles: false},
+		{printFiles: true, maxDepth: 2, summary: true},
+		{printFiles: true, du: true, exclude: []string{"*.png"}},
+	}
+	for _, opts := range cases {
+		expected := new(bytes.Buffer)
+		if err := dirTreeOpts(expected, "testdata", opts); err != nil {
+			t.Fatalf("serial walk failed: %v", err)
+		}
+
+		opts.workers = 4
+		for i := 0; i < 10; i++ {
+			out := new(bytes.Buffer)
+			if err := dirTreeOpts(out, "testdata", opts); err != nil {
+				t.Fatalf("parallel walk failed: %v", err)
+			}
+			if out.String() != expected.String() {
+				t.Fatalf("parallel result differs for %+v\nGot:\n%v\nExpected:\n%v", opts, out, expected)
+			}
+		}
+	}
+}
+
+func makeLinkTree(t *testing.T) string {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "dir", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "dir", "file.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"broken":          "missing.txt",
+		"dir/sub/loop":    "../..",
+		"file.lnk":        "dir/file.txt",
+		"linked":          "dir",
+		"dir/sub/outside": "../../dir/file.txt",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+	return root
+}
+
+const testLinksResult = `├───broken -> missing.txt (11b) [broken link]
+├───dir
+│	├───file.txt (5b)
+│	└───sub
+│		├───loop -> ../.. (5b)
+│		└───outside -> ../../dir/file.txt (18b)
+├───file.lnk -> dir/file.txt (12b)
+└───linked -> dir (3b)
+`
+
+func TestTreeLinks(t *testing.T) {
+	root := makeLinkTree(t)
+
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, root, options{printFiles: true})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testLinksResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testLinksResult)
+	}
+}
+
+const testFollowLinksResult = `├───dir
+│	└───sub
+│		└───loop -> ../.. [recursive, not followed]
+└───linked -> dir
+	└───sub
+		└───loop -> ../.. [recursive, not followed]
+
+6 directories
+`
+
+func TestTreeFollowLinks(t *testing.T) {
+	root := makeLinkTree(t)
+
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, root, options{printFiles: false, followLinks: true, summary: true})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testFollowLinksResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testFollowLinksResult)
+	}
+}
+
+// noInodeFS прячет device/inode, как на системах, где их нет
+type noInodeFS struct {
+	osFS
+}
+
+type noInodeInfo struct {
+	fs.FileInfo
+}
+
+func (noInodeInfo) Sys() interface{} {
+	return nil
+}
+
+type noInodeEntry struct {
+	fs.DirEntry
+}
+
+func (e noInodeEntry) Info() (fs.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return noInodeInfo{info}, nil
+}
+
+func (f noInodeFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := f.osFS.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return noInodeInfo{info}, nil
+}
+
+func (f noInodeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := f.osFS.ReadDir(name)
+	for i, entry := range entries {
+		entries[i] = noInodeEntry{entry}
+	}
+	return entries, err
+}
+
+func TestTreeFollowLinksByPath(t *testing.T) {
+	root := makeLinkTree(t)
+
+	out := new(bytes.Buffer)
+	err := dirTreeFS(out, noInodeFS{newOSFS(root)}, root, options{printFiles: false, followLinks: true, summary: true})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testFollowLinksResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testFollowLinksResult)
+	}
+}
+
+// poolFS отмечает Info, ReadLink и Stat элементов, сделанные не в пуле чтения каталогов
+type poolFS struct {
+	osFS
+	mu      sync.Mutex
+	outside []string
+}
+
+type poolEntry struct {
+	fs.DirEntry
+	fsys *poolFS
+	name string
+}
+
+func (e poolEntry) Info() (fs.FileInfo, error) {
+	e.fsys.check(e.name)
+	return e.DirEntry.Info()
+}
+
+func (f *poolFS) check(name string) {
+	pc := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pc[:runtime.Callers(2, pc)])
+	for {
+		frame, more := frames.Next()
+		if strings.HasSuffix(frame.Function, ".(*lookahead).run") {
+			return
+		}
+		if !more {
+			break
+		}
+	}
+	// корень читается сразу, без пула
+	if path.Dir(name) != "." {
+		f.mu.Lock()
+		f.outside = append(f.outside, name)
+		f.mu.Unlock()
+	}
+}
+
+func (f *poolFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := f.osFS.ReadDir(name)
+	for i, entry := range entries {
+		entries[i] = poolEntry{entry, f, path.Join(name, entry.Name())}
+	}
+	return entries, err
+}
+
+func (f *poolFS) ReadLink(name string) (string, error) {
+	f.check(name)
+	return f.osFS.ReadLink(name)
+}
+
+func (f *poolFS) Stat(name string) (fs.FileInfo, error) {
+	if name != "." {
+		f.check(name)
+	}
+	return f.osFS.Stat(name)
+}
+
+func TestTreeParallelInfo(t *testing.T) {
+	root := makeLinkTree(t)
+	fsys := &poolFS{osFS: newOSFS(root)}
+
+	out := new(bytes.Buffer)
+	if err := dirTreeFS(out, fsys, root, options{printFiles: true, workers: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if result := out.String(); result != testLinksResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, testLinksResult)
+	}
+	if len(fsys.outside) > 0 {
+		t.Errorf("info read outside the pool: %v", fsys.outside)
+	}
+}
+
+func TestTreePermissionDenied(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read any directory")
+	}
+	root := t.TempDir()
+	for _, dir := range []string{"a", "locked/inner", "z"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	locked := filepath.Join(root, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+
+	expected := "├───a\n├───locked [permission denied]\n└───z\n"
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, root, options{})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != expected {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+const testMapFSResult = `├───cmd
+│	└───tree
+│		└───main.go (12b)
+├───docs
+│	└───readme.md (empty)
+└───go.mod (9b)
+`
+
+func TestTreeMapFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"go.mod":           {Data: []byte("module hw")},
+		"cmd/tree/main.go": {Data: []byte("package main")},
+		"docs/readme.md":   {},
+	}
+
+	out := new(bytes.Buffer)
+	err := dirTreeFS(out, fsys, ".", options{printFiles: true})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testMapFSResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testMapFSResult)
+	}
+}
+
+func TestTreeArchives(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"cmd/tree/main.go": "package main",
+		"docs/readme.md":   "",
+		"go.mod":           "module hw",
+	}
+
+	zipPath := filepath.Join(dir, "tree.zip")
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(zipFile)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	zipFile.Close()
+
+	tarPath := filepath.Join(dir, "tree.tar.gz")
+	tarFile, err := os.Create(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(tarFile)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.WriteHeader(&tar.Header{Name: "docs/index.md", Linkname: "readme.md", Typeflag: tar.TypeSymlink})
+	tw.Close()
+	gz.Close()
+	tarFile.Close()
+
+	expected := map[string]string{
+		zipPath: testMapFSResult,
+		tarPath: strings.Replace(testMapFSResult, "│	└───readme.md", "│	├───index.md -> readme.md (9b)\n│	└───readme.md", 1),
+	}
+	for name, want := range expected {
+		fsys, closeSource, err := openSource(name, false)
+		if err != nil {
+			t.Fatalf("can't open %s: %v", name, err)
+		}
+		out := new(bytes.Buffer)
+		err = dirTreeFS(out, fsys, name, options{printFiles: true})
+		closeSource()
+		if err != nil {
+			t.Errorf("test for OK Failed - error")
+		}
+		result := out.String()
+		if result != want {
+			t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, want)
+		}
+	}
+}
+
+func TestArchiveContents(t *testing.T) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for name, content := range map[string]string{"a/b.txt": "hello", "c.txt": "hello"} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.WriteHeader(&tar.Header{Name: "a/lnk", Linkname: "b.txt", Typeflag: tar.TypeSymlink})
+	tw.Close()
+
+	// без хешей содержимое не читается, размеры - из заголовков
+	fsys, err := readTar(bytes.NewReader(buf.Bytes()), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsys.files["c.txt"].data != nil {
+		t.Errorf("contents loaded without hashing")
+	}
+	if _, err := fsys.Open("c.txt"); !errors.Is(err, errNoContents) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	out := new(bytes.Buffer)
+	if err := dirTreeFS(out, fsys, ".", options{printFiles: true}); err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	expected := "├───a\n│	├───b.txt (5b)\n│	└───lnk -> b.txt (5b)\n└───c.txt (5b)\n"
+	if out.String() != expected {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", out, expected)
+	}
+
+	fsys, err = readTar(bytes.NewReader(buf.Bytes()), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, "a/b.txt", "c.txt"); err != nil {
+		t.Error(err)
+	}
+	out.Reset()
+	if err := dirTreeFS(out, fsys, "x.tar.gz", options{dupes: true, hash: hashXX}); err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	expected = "5b, 2 files, xxhash:26c7827d889f6da3\n\tx.tar.gz/a/b.txt\n\tx.tar.gz/c.txt\n"
+	if out.String() != expected {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", out, expected)
+	}
+}
+
+const testSortResult = `├───static (275.0KiB)
+│	├───z_lorem (137.4KiB)
+│	├───a_lorem (137.4KiB)
+│	├───html (57B)
+│	├───css (28B)
+│	├───js (10B)
+│	└───empty.txt (empty)
+├───zline (137.4KiB)
+│	├───lorem (137.4KiB)
+│	└───empty.txt (empty)
+├───project (68.7KiB)
+│	├───gopher.png (68.7KiB)
+│	└───file.txt (19B)
+└───zzfile.txt (empty)
+`
+
+func TestTreeSortSize(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, "testdata", options{
+		printFiles: true,
+		maxDepth:   2,
+		du:         true,
+		sortBy:     sortSize,
+		reverse:    true,
+		dirsFirst:  true,
+		sizeUnits:  unitsIEC,
+	})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testSortResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testSortResult)
+	}
+}
+
+func TestTreeSortMtimeColumns(t *testing.T) {
+	root := t.TempDir()
+	base := time.Date(2021, time.March, 4, 5, 6, 0, 0, time.Local)
+	for i, name := range []string{"c.txt", "a.txt", "b.txt"} {
+		full := filepath.Join(root, name)
+		if err := os.WriteFile(full, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chmod(full, 0640)
+		mtime := base.Add(time.Duration(i) * time.Hour)
+		if err := os.Chtimes(full, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := "├───[-rw-r----- 2021-03-04 05:06] c.txt (empty)\n" +
+		"├───[-rw-r----- 2021-03-04 06:06] a.txt (empty)\n" +
+		"└───[-rw-r----- 2021-03-04 07:06] b.txt (empty)\n"
+
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, root, options{printFiles: true, sortBy: sortMtime, showPerm: true, showTime: true})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != expected {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	cases := []struct {
+		size     int64
+		units    string
+		expected string
+	}{
+		{0, unitsIEC, "empty"},
+		{70372, "", "70372b"},
+		{512, unitsIEC, "512B"},
+		{70372, unitsIEC, "68.7KiB"},
+		{70372, unitsSI, "70.4kB"},
+		{5 << 30, unitsIEC, "5.0GiB"},
+		{2500000, unitsSI, "2.5MB"},
+	}
+	for _, c := range cases {
+		if got := formatSize(c.size, c.units); got != c.expected {
+			t.Errorf("formatSize(%d, %q) = %q, expected %q", c.size, c.units, got, c.expected)
+		}
+	}
+}
+
+func TestRunArgs(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"testdata", "-f"}, stdout, stderr); code != exitOK {
+		t.Fatalf("unexpected exit code %d, stderr: %s", code, stderr)
+	}
+	if stdout.String() != testFullResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", stdout, testFullResult)
+	}
+
+	stdout.Reset()
+	expected := "testdata/project\n├───file.txt (19b)\n└───gopher.png (70372b)\n" +
+		"testdata/static/css\n└───body.css (28b)\n"
+	if code := run([]string{"-f", "testdata/project", "testdata/static/css"}, stdout, stderr); code != exitOK {
+		t.Fatalf("unexpected exit code %d, stderr: %s", code, stderr)
+	}
+	if stdout.String() != expected {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", stdout, expected)
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	cases := []struct {
+		args   []string
+		code   int
+		stdout bool
+		stderr bool
+	}{
+		{[]string{"--help"}, exitOK, true, false},
+		{[]string{"--bogus", "testdata"}, exitUsage, false, true},
+		{[]string{"-L", "-1", "testdata"}, exitUsage, false, true},
+		{[]string{"--sort", "color", "testdata"}, exitUsage, false, true},
+		{[]string{"testdata/missing", "testdata/project"}, exitSource, true, true},
+		{[]string{"testdata/missing"}, exitSource, false, true},
+	}
+	for _, c := range cases {
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		code := run(c.args, stdout, stderr)
+		if code != c.code {
+			t.Errorf("%v: exit code %d, expected %d", c.args, code, c.code)
+		}
+		if (stdout.Len() > 0) != c.stdout || (stderr.Len() > 0) != c.stderr {
+			t.Errorf("%v: unexpected output\nstdout:\n%s\nstderr:\n%s", c.args, stdout, stderr)
+		}
+	}
+}
+
+func TestRunColor(t *testing.T) {
+	t.Setenv("LS_COLORS", "di=01;33:*.png=35")
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"--color", "always", "-f", "testdata/zline"}, stdout, stderr); code != exitOK {
+		t.Fatalf("unexpected exit code %d, stderr: %s", code, stderr)
+	}
+	expected := "├───empty.txt (empty)\n" +
+		"└───\x1b[01;33mlorem\x1b[0m\n" +
+		"	├───dolor.txt (empty)\n" +
+		"	├───\x1b[35mgopher.png\x1b[0m (70372b)\n" +
+		"	└───\x1b[01;33mipsum\x1b[0m\n" +
+		"		└───\x1b[35mgopher.png\x1b[0m (70372b)\n"
+	if stdout.String() != expected {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%q\nExpected:\n%q", stdout, expected)
+	}
+
+	// значение можно дать и через пробел, и через =; буфер - не терминал
+	for _, args := range [][]string{
+		{"--color", "auto", "-f", "testdata/zline"},
+		{"--color=never", "-f", "testdata/zline"},
+	} {
+		stdout.Reset()
+		if code := run(args, stdout, stderr); code != exitOK {
+			t.Fatalf("%v: unexpected exit code %d, stderr: %s", args, code, stderr)
+		}
+		if strings.Contains(stdout.String(), "\x1b[") {
+			t.Errorf("%v: unexpected colors:\n%q", args, stdout)
+		}
+	}
+	if code := run([]string{"--color", "-f", "testdata/zline"}, stdout, stderr); code != exitUsage {
+		t.Errorf("--color without a value: exit code %d, expected %d", code, exitUsage)
+	}
+}
+
+const testDiffResult = `├───~ cmd
+│	└───~ tree
+│		├───~ main.go (12b -> 19b)
+│		└───+ util.go (4b)
+├───- docs
+│	└───- readme.md (empty)
+└───go.mod (9b)
+`
+
+func TestTreeDiff(t *testing.T) {
+	old := fstest.MapFS{
+		"go.mod":           {Data: []byte("module hw")},
+		"cmd/tree/main.go": {Data: []byte("package main")},
+		"docs/readme.md":   {},
+	}
+	cur := fstest.MapFS{
+		"go.mod":           {Data: []byte("module hw")},
+		"cmd/tree/main.go": {Data: []byte("package main\n\n// ok")},
+		"cmd/tree/util.go": {Data: []byte("util")},
+	}
+
+	out := new(bytes.Buffer)
+	err := dirTreeDiffFS(out, old, cur, options{printFiles: true})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testDiffResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testDiffResult)
+	}
+
+	out.Reset()
+	err = dirTreeDiffFS(out, old, cur, options{printFiles: true, format: formatJSON})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	var nodes []*diffNode
+	if err := json.Unmarshal(out.Bytes(), &nodes); err != nil {
+		t.Fatalf("bad json: %v\n%s", err, out.String())
+	}
+	main := nodes[0].Contents[0].Contents[0].Contents[0]
+	if main.Name != "main.go" || main.Status != statusChanged || *main.OldSize != 12 || *main.Size != 19 {
+		t.Errorf("unexpected diff for main.go: %+v", main)
+	}
+}
+
+func TestTreeDiffSnapshot(t *testing.T) {
+	saved := new(bytes.Buffer)
+	err := dirTreeOpts(saved, "testdata", options{printFiles: true, format: formatJSON, summary: true})
+	if err != nil {
+		t.Fatalf("can't save snapshot: %v", err)
+	}
+	old, err := loadSnapshot(saved)
+	if err != nil {
+		t.Fatalf("can't load snapshot: %v", err)
+	}
+	cur, err := snapshotSource(source{name: "testdata", fsys: newOSFS("testdata")}, options{printFiles: true})
+	if err != nil {
+		t.Fatalf("can't walk testdata: %v", err)
+	}
+
+	out := new(bytes.Buffer)
+	if err = dirTreeDiff(out, old, cur, options{printFiles: true}); err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testFullResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testFullResult)
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	old, cur := t.TempDir(), t.TempDir()
+	files := []struct {
+		root, name, data string
+	}{
+		{old, "sub/f", "ab"},
+		{cur, "sub/f", "abc"},
+		{cur, "sub/new", ""},
+	}
+	for _, f := range files {
+		name := filepath.Join(f.root, filepath.FromSlash(f.name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(f.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	if code := run([]string{"--diff", old, cur}, stdout, stderr); code != exitOK {
+		t.Fatalf("unexpected exit code %d, stderr: %s", code, stderr)
+	}
+	expected := "└───~ sub\n\t├───~ f (2b -> 3b)\n\t└───+ new (empty)\n"
+	if stdout.String() != expected {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", stdout, expected)
+	}
+}
+
+func TestTreeHash(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt": {Data: []byte("hello")},
+		"b.txt": {Data: []byte("")},
+	}
+	expected := map[string]string{
+		hashSHA256: "├───a.txt (5b) sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824\n" +
+			"└───b.txt (empty) sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n",
+		hashXX: "├───a.txt (5b) xxhash:26c7827d889f6da3\n" +
+			"└───b.txt (empty) xxhash:ef46db3751d8e999\n",
+	}
+	for algo, want := range expected {
+		out := new(bytes.Buffer)
+		err := dirTreeFS(out, fsys, ".", options{printFiles: true, hash: algo, workers: 2})
+		if err != nil {
+			t.Errorf("test for OK Failed - error")
+		}
+		result := out.String()
+		if result != want {
+			t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, want)
+		}
+	}
+
+	if err := dirTreeFS(new(bytes.Buffer), fsys, ".", options{hash: "md5"}); err == nil {
+		t.Errorf("expected error for unknown hash")
+	}
+}
+
+func TestTreeHashLinks(t *testing.T) {
+	root := makeLinkTree(t)
+
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, root, options{printFiles: true, hash: hashXX})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.Contains(line, " -> ") && (strings.Contains(line, "xxhash:") || strings.Contains(line, "is a directory")) {
+			t.Errorf("not followed link is hashed: %q", line)
+		}
+	}
+
+	// без -l ссылка на файл - не копия файла
+	out.Reset()
+	err = dirTreeOpts(out, root, options{dupes: true, hash: hashXX})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	if out.Len() != 0 {
+		t.Errorf("unexpected dupes:\n%v", out)
+	}
+}
+
+const testDupesResult = `68.7KiB, 7 files, xxhash:c8704ebed762650c
+	testdata/project/gopher.png
+	testdata/static/a_lorem/gopher.png
+	testdata/static/a_lorem/ipsum/gopher.png
+	testdata/static/z_lorem/gopher.png
+	testdata/static/z_lorem/ipsum/gopher.png
+	testdata/zline/lorem/gopher.png
+	testdata/zline/lorem/ipsum/gopher.png
+`
+
+func TestTreeDupes(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := dirTreeOpts(out, "testdata", options{dupes: true, hash: hashXX, sizeUnits: unitsIEC})
+	if err != nil {
+		t.Errorf("test for OK Failed - error")
+	}
+	result := out.String()
+	if result != testDupesResult {
+		t.Errorf("test for OK Failed - results not match\nGot:\n%v\nExpected:\n%v", result, testDupesResult)
+	}
+}
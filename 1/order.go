@@ -0,0 +1,81 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sortName  = "name"
+	sortSize  = "size"
+	sortMtime = "mtime"
+	sortExt   = "ext"
+)
+
+func validSort(by string) bool {
+	switch by {
+	case "", sortName, sortSize, sortMtime, sortExt:
+		return true
+	}
+	return false
+}
+
+func nodeBytes(n node) int64 {
+	if n.du >= 0 {
+		return n.du
+	}
+	info, err := n.Info()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+func nodeTime(n node) time.Time {
+	info, err := n.Info()
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// compareNodes возвращает <0, 0 или >0; при равенстве ключа сравниваем по имени
+func compareNodes(a, b node, by string) int {
+	switch by {
+	case sortSize:
+		if sa, sb := nodeBytes(a), nodeBytes(b); sa != sb {
+			if sa < sb {
+				return -1
+			}
+			return 1
+		}
+	case sortMtime:
+		if ta, tb := nodeTime(a), nodeTime(b); !ta.Equal(tb) {
+			if ta.Before(tb) {
+				return -1
+			}
+			return 1
+		}
+	case sortExt:
+		if c := strings.Compare(path.Ext(a.Name()), path.Ext(b.Name())); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a.Name(), b.Name())
+}
+
+// sortNodes упорядочивает уровень; reverse не переносит каталоги в конец при dirsFirst
+func sortNodes(list []node, opts options) {
+	sort.Slice(list, func(i, j int) bool {
+		if opts.dirsFirst && list[i].IsDir() != list[j].IsDir() {
+			return list[i].IsDir()
+		}
+		c := compareNodes(list[i], list[j], opts.sortBy)
+		if opts.reverse {
+			return c > 0
+		}
+		return c < 0
+	})
+}
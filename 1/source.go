@@ -0,0 +1,99 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readLinkFS - источник, который умеет показывать, куда указывают симлинки
+type readLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+}
+
+// realPathFS - источник, который знает путь файла без симлинков
+type realPathFS interface {
+	fs.FS
+	RealPath(name string) (string, error)
+}
+
+// osFS - os.DirFS, который ещё умеет читать и раскрывать симлинки
+type osFS struct {
+	fs.FS
+	root string
+}
+
+func newOSFS(root string) osFS {
+	return osFS{FS: os.DirFS(root), root: root}
+}
+
+func (f osFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(f.FS, name)
+}
+
+func (f osFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(f.FS, name)
+}
+
+func (f osFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Readlink(filepath.Join(f.root, filepath.FromSlash(name)))
+}
+
+func (f osFS) RealPath(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "realpath", Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.EvalSymlinks(filepath.Join(f.root, filepath.FromSlash(name)))
+}
+
+func noClose() error {
+	return nil
+}
+
+// openSource открывает каталог, .zip или .tar.gz как файловую систему.
+// withContents - файлы будут читаться (хеши): у .tar.gz их нельзя прочитать потом
+func openSource(name string, withContents bool) (fs.FS, func() error, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		zr, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr.Close, nil
+
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer file.Close()
+
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		fsys, err := readTar(gz, withContents)
+		if err != nil {
+			return nil, nil, err
+		}
+		return fsys, noClose, nil
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.IsDir() {
+		return nil, nil, errors.New(name + " is not a directory or a supported archive")
+	}
+	return newOSFS(name), noClose, nil
+}
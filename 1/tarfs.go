@@ -0,0 +1,218 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+var errNoContents = errors.New("archive contents were not loaded")
+
+// tarInfo - информация об элементе архива, размер берётся из заголовка
+type tarInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i tarInfo) Name() string       { return i.name }
+func (i tarInfo) Size() int64        { return i.size }
+func (i tarInfo) Mode() fs.FileMode  { return i.mode }
+func (i tarInfo) ModTime() time.Time { return i.modTime }
+func (i tarInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i tarInfo) Sys() interface{}   { return nil }
+
+// tarEntry - элемент архива; содержимое файла есть, только если его читали
+type tarEntry struct {
+	info     tarInfo
+	data     []byte      // содержимое файла или nil, у симлинка - цель
+	children []*tarEntry // содержимое каталога по именам
+}
+
+func dirEntries(list []*tarEntry) []fs.DirEntry {
+	entries := make([]fs.DirEntry, len(list))
+	for i, e := range list {
+		entries[i] = fs.FileInfoToDirEntry(e.info)
+	}
+	return entries
+}
+
+// archiveFS - дерево tar-архива в памяти, построенное по одним заголовкам
+type archiveFS struct {
+	files map[string]*tarEntry
+}
+
+func (f archiveFS) lookup(op, name string) (*tarEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := f.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return e, nil
+}
+
+func (f archiveFS) Open(name string) (fs.File, error) {
+	e, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.info.IsDir() {
+		return &tarDir{entry: e}, nil
+	}
+	if e.data == nil && e.info.size > 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errNoContents}
+	}
+	return &tarFile{Reader: bytes.NewReader(e.data), info: e.info}, nil
+}
+
+func (f archiveFS) Stat(name string) (fs.FileInfo, error) {
+	e, err := f.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return e.info, nil
+}
+
+func (f archiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := f.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return dirEntries(e.children), nil
+}
+
+func (f archiveFS) ReadLink(name string) (string, error) {
+	e, err := f.lookup("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	if e.info.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return string(e.data), nil
+}
+
+type tarFile struct {
+	*bytes.Reader
+	info tarInfo
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *tarFile) Close() error {
+	return nil
+}
+
+type tarDir struct {
+	entry  *tarEntry
+	offset int
+}
+
+func (d *tarDir) Stat() (fs.FileInfo, error) {
+	return d.entry.info, nil
+}
+
+func (d *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *tarDir) Close() error {
+	return nil
+}
+
+func (d *tarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entry.children[d.offset:]
+	if n > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && len(rest) > n {
+		rest = rest[:n]
+	}
+	d.offset += len(rest)
+	return dirEntries(rest), nil
+}
+
+// readTar читает заголовки архива. Содержимое файлов остаётся в памяти,
+// только если withContents (нужно для хешей) и для .gitignore
+func readTar(r io.Reader, withContents bool) (archiveFS, error) {
+	files := map[string]*tarEntry{
+		".": {info: tarInfo{name: ".", mode: fs.ModeDir | 0555}},
+	}
+	// dir находит каталог, недостающие родители создаются по дороге
+	var dir func(name string) *tarEntry
+	dir = func(name string) *tarEntry {
+		if e, ok := files[name]; ok {
+			return e
+		}
+		e := &tarEntry{info: tarInfo{name: path.Base(name), mode: fs.ModeDir | 0555}}
+		files[name] = e
+		parent := dir(path.Dir(name))
+		parent.children = append(parent.children, e)
+		return e
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return archiveFS{}, err
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if name == "." || !fs.ValidPath(name) {
+			continue
+		}
+		info := tarInfo{name: path.Base(name), size: hdr.Size, mode: hdr.FileInfo().Mode(), modTime: hdr.ModTime}
+		if hdr.Typeflag == tar.TypeDir {
+			info.size = 0
+			dir(name).info = info
+			continue
+		}
+
+		e := &tarEntry{info: info}
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			e.data = []byte(hdr.Linkname)
+			e.info.size = int64(len(e.data))
+		case tar.TypeReg:
+			if withContents || info.name == ".gitignore" {
+				if e.data, err = io.ReadAll(tr); err != nil {
+					return archiveFS{}, err
+				}
+			}
+		}
+		// повторный заголовок заменяет прежний, как при распаковке
+		if old, ok := files[name]; ok {
+			e.children = old.children
+			*old = *e
+			continue
+		}
+		files[name] = e
+		parent := dir(path.Dir(name))
+		parent.children = append(parent.children, e)
+	}
+
+	for _, e := range files {
+		sort.Slice(e.children, func(i, j int) bool {
+			return e.children[i].info.name < e.children[j].info.name
+		})
+	}
+	return archiveFS{files}, nil
+}
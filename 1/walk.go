@@ -0,0 +1,377 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+)
+
+var (
+	errBrokenLink = errors.New("broken link")
+	errRecursive  = errors.New("recursive, not followed")
+)
+
+// node - элемент дерева вместе с тем, что вычислено при обходе
+type node struct {
+	os.DirEntry
+	dir    bool
+	info   os.FileInfo // прочитанная заранее информация, у пройденного симлинка - о цели
+	target string      // куда указывает симлинк
+	du     int64       // суммарный размер содержимого каталога, -1 если не считали
+	digest string      // хеш содержимого файла в hex, если его просили
+	err    error       // ошибка, которую надо показать рядом с элементом
+}
+
+func (n node) IsDir() bool {
+	return n.dir
+}
+
+func (n node) Info() (os.FileInfo, error) {
+	if n.info != nil {
+		return n.info, nil
+	}
+	return n.DirEntry.Info()
+}
+
+func errText(err error) string {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err.Error()
+	}
+	return err.Error()
+}
+
+type summary struct {
+	dirs  int
+	files int
+}
+
+// listing - каталог, прочитанный при подсчёте --du; вывод берёт его готовым
+type listing struct {
+	list   []node
+	ignore *ignoreList
+	err    error
+}
+
+type walker struct {
+	fsys      fs.FS
+	render    renderer
+	opts      options
+	sizes     map[string]int64
+	listings  map[string]listing
+	count     *summary
+	fetch     *lookahead
+	hashes    *lookahead
+	ancestors map[fileID]bool
+}
+
+// needInfo - выводу или сортировке нужны размер, права или время элементов,
+// а не только имя и тип из списка каталога
+func (o options) needInfo() bool {
+	return o.printFiles || o.du || o.showPerm || o.showTime || o.colors != nil || o.hash != "" ||
+		(o.format != "" && o.format != formatText) || o.sortBy == sortSize || o.sortBy == sortMtime
+}
+
+// newNode готовит элемент: у os.DirFS Info и цель симлинка - отдельные
+// системные вызовы, поэтому они делаются здесь, в пуле чтения каталогов
+func (w *walker) newNode(dir string, entry os.DirEntry) node {
+	n := node{DirEntry: entry, dir: entry.IsDir(), du: -1}
+	if w.opts.needInfo() {
+		if info, err := entry.Info(); err == nil {
+			n.info = info
+		}
+	}
+	links, ok := w.fsys.(readLinkFS)
+	if !ok || entry.Type()&os.ModeSymlink == 0 {
+		return n
+	}
+
+	full := path.Join(dir, entry.Name())
+	n.target, n.err = links.ReadLink(full)
+	if n.err != nil {
+		return n
+	}
+	info, err := fs.Stat(w.fsys, full)
+	if errors.Is(err, fs.ErrNotExist) {
+		n.err = errBrokenLink
+		return n
+	}
+	if err != nil {
+		n.err = err
+		return n
+	}
+	if w.opts.followLinks {
+		n.info = info
+		n.dir = info.IsDir()
+	}
+	return n
+}
+
+func (w *walker) skip(n node, name string, ignore *ignoreList) bool {
+	if matchAny(w.opts.exclude, n.Name()) {
+		return true
+	}
+	if !n.IsDir() && len(w.opts.include) > 0 && !matchAny(w.opts.include, n.Name()) {
+		return true
+	}
+	if w.opts.gitignore {
+		if n.IsDir() && n.Name() == ".git" {
+			return true
+		}
+		return ignore.ignored(name, n.IsDir())
+	}
+	return false
+}
+
+// listDir - все элементы каталога, готовые к выводу. Может работать в пуле
+func (w *walker) listDir(dir string) ([]node, error) {
+	entries, err := fs.ReadDir(w.fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]node, len(entries))
+	for i, entry := range entries {
+		nodes[i] = w.newNode(dir, entry)
+	}
+	return nodes, nil
+}
+
+// readDir возвращает отфильтрованный список каталога, порядок наводит dfsDirTree
+func (w *walker) readDir(dir string, ignore *ignoreList) ([]node, *ignoreList, error) {
+	var nodes []node
+	var err error
+	if w.fetch != nil {
+		var v interface{}
+		v, err = w.fetch.get(dir)
+		nodes, _ = v.([]node)
+	} else {
+		nodes, err = w.listDir(dir)
+	}
+	if err != nil {
+		return nil, ignore, err
+	}
+
+	if w.opts.gitignore {
+		ignore, err = readIgnoreFile(w.fsys, ignore, dir)
+		if err != nil {
+			return nil, ignore, err
+		}
+	}
+
+	list := make([]node, 0, len(nodes))
+	for _, n := range nodes {
+		if w.skip(n, path.Join(dir, n.Name()), ignore) {
+			continue
+		}
+		list = append(list, n)
+	}
+	return list, ignore, nil
+}
+
+func (w *walker) prefetch(dir string, list []node) {
+	if w.fetch == nil {
+		return
+	}
+	for _, n := range list {
+		full := path.Join(dir, n.Name())
+		if _, listed := w.listings[full]; n.IsDir() && n.err == nil && !listed {
+			w.fetch.schedule(full)
+		}
+	}
+}
+
+// hashable - у файла можно посчитать хеш; симлинк хешируется, только если по ним ходим
+func (w *walker) hashable(n node) bool {
+	return w.hashes != nil && !n.IsDir() && n.err == nil && (n.target == "" || w.opts.followLinks)
+}
+
+func (w *walker) scheduleHashes(dir string, list []node) {
+	for _, n := range list {
+		if w.hashable(n) {
+			w.hashes.schedule(path.Join(dir, n.Name()))
+		}
+	}
+}
+
+func (w *walker) hash(n *node, name string) {
+	if !w.hashable(*n) {
+		return
+	}
+	v, err := w.hashes.get(name)
+	if err != nil {
+		n.err = err
+		return
+	}
+	n.digest = v.(string)
+}
+
+// fileID - один и тот же каталог, под каким бы путём его ни нашли
+type fileID struct {
+	dev  uint64
+	ino  uint64
+	path string // путь без симлинков, если device/inode не узнать
+}
+
+// identity - device/inode каталога, а если система их не даёт - путь без симлинков
+func (w *walker) identity(n node, name string) (fileID, bool) {
+	if info, err := n.Info(); err == nil {
+		if id, ok := fileIdentity(info); ok {
+			return id, true
+		}
+	}
+	if real, ok := w.fsys.(realPathFS); ok {
+		if p, err := real.RealPath(name); err == nil {
+			return fileID{path: p}, true
+		}
+	}
+	return fileID{}, false
+}
+
+// push запоминает каталог как предка текущего, false - каталог уже есть на пути, это цикл
+func (w *walker) push(n node, name string) bool {
+	if !w.opts.followLinks {
+		return true
+	}
+	id, ok := w.identity(n, name)
+	if !ok {
+		return true
+	}
+	if w.ancestors[id] {
+		return false
+	}
+	w.ancestors[id] = true
+	return true
+}
+
+func (w *walker) pop(n node, name string) {
+	if !w.opts.followLinks {
+		return
+	}
+	if id, ok := w.identity(n, name); ok {
+		delete(w.ancestors, id)
+	}
+}
+
+// openDir читает каталог-потомок, ошибка чтения или цикл остаются в n.err
+func (w *walker) openDir(n *node, dir string, ignore *ignoreList) ([]node, *ignoreList, bool) {
+	if n.err != nil {
+		return nil, ignore, false
+	}
+	if !w.push(*n, dir) {
+		n.err = errRecursive
+		return nil, ignore, false
+	}
+	list, ignore, err := w.readDir(dir, ignore)
+	if err != nil {
+		w.pop(*n, dir)
+		n.err = err
+		return nil, ignore, false
+	}
+	return list, ignore, true
+}
+
+// enterDir - openDir, но каталог, уже прочитанный для --du, второй раз не читается
+func (w *walker) enterDir(n *node, dir string, ignore *ignoreList) ([]node, *ignoreList, bool) {
+	l, ok := w.listings[dir]
+	if !ok {
+		return w.openDir(n, dir, ignore)
+	}
+	delete(w.listings, dir)
+	if l.err != nil {
+		n.err = l.err
+		return nil, ignore, false
+	}
+	// тот же путь уже прошёл проверку на цикл, push нужен для парного pop
+	w.push(*n, dir)
+	return l.list, l.ignore, true
+}
+
+// duDirTree - обход в обратном порядке: размер каталога известен только после его детей
+func (w *walker) duDirTree(dir string, list []node, ignore *ignoreList) int64 {
+	w.prefetch(dir, list)
+
+	var total int64
+	for _, n := range list {
+		full := path.Join(dir, n.Name())
+		if n.IsDir() {
+			children, childIgnore, ok := w.openDir(&n, full, ignore)
+			w.listings[full] = listing{list: children, ignore: childIgnore, err: n.err}
+			if ok {
+				total += w.duDirTree(full, children, childIgnore)
+				w.pop(n, full)
+			}
+			continue
+		}
+		if info, err := n.Info(); err == nil {
+			total += info.Size()
+		}
+	}
+
+	w.sizes[dir] = total
+	return total
+}
+
+func (w *walker) dfsDirTree(dir string, depth int, list []node, ignore *ignoreList) error {
+	if !w.opts.printFiles {
+		var newList []node
+		for _, n := range list {
+			if n.IsDir() {
+				newList = append(newList, n)
+			}
+		}
+		list = newList
+	}
+
+	for i := range list {
+		if sz, ok := w.sizes[path.Join(dir, list[i].Name())]; ok && list[i].IsDir() {
+			list[i].du = sz
+		}
+	}
+	sortNodes(list, w.opts)
+
+	descend := w.opts.maxDepth <= 0 || depth < w.opts.maxDepth
+	if descend {
+		w.prefetch(dir, list)
+	}
+	w.scheduleHashes(dir, list)
+
+	for idx, n := range list {
+		last := idx == len(list)-1
+		if !n.IsDir() {
+			w.hash(&n, path.Join(dir, n.Name()))
+			w.count.files++
+			if err := w.render.entry(n, last); err != nil {
+				return err
+			}
+			continue
+		}
+		w.count.dirs++
+
+		full := path.Join(dir, n.Name())
+		var children []node
+		childIgnore := ignore
+		opened := false
+		if descend {
+			children, childIgnore, opened = w.enterDir(&n, full, ignore)
+		}
+
+		if err := w.render.entry(n, last); err != nil {
+			return err
+		}
+		if err := w.render.enter(); err != nil {
+			return err
+		}
+		if opened {
+			err := w.dfsDirTree(full, depth+1, children, childIgnore)
+			w.pop(n, full)
+			if err != nil {
+				return err
+			}
+		}
+		if err := w.render.leave(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Store - хранилище готовых подписей по ключу
+type Store interface {
+	Get(key string) (string, bool)
+	Set(key, val string)
+}
+
+type lruEntry struct {
+	key     string
+	val     string
+	expires time.Time
+}
+
+// LRU - хранилище в памяти на size записей, каждая живёт ttl (0 - всегда)
+type LRU struct {
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	order *list.List // в начале - недавно использованные
+	items map[string]*list.Element
+}
+
+func NewLRU(size int, ttl time.Duration) *LRU {
+	return &LRU{size: size, ttl: ttl, order: list.New(), items: map[string]*list.Element{}}
+}
+
+func (c *LRU) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	entry := elem.Value.(*lruEntry)
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		return "", false
+	}
+	c.order.MoveToFront(elem)
+	return entry.val, true
+}
+
+func (c *LRU) Set(key, val string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.val, entry.expires = val, expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry{key, val, expires})
+	for c.size > 0 && c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// DiskStore хранит подписи файлами в dir и переживает перезапуск.
+// Ошибки диска не ломают расчёт - запись просто считается промахом
+type DiskStore struct {
+	dir string
+}
+
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskStore{dir: dir}, nil
+}
+
+func (d *DiskStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:]))
+}
+
+func (d *DiskStore) Get(key string) (string, bool) {
+	data, err := os.ReadFile(d.path(key))
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// Set пишет через временный файл, чтобы параллельный Get не увидел половину
+func (d *DiskStore) Set(key, val string) {
+	tmp, err := os.CreateTemp(d.dir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.WriteString(val)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), d.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+type flight struct {
+	done chan struct{}
+	val  string
+}
+
+// Memo запоминает результаты функции подписи в хранилищах по порядку:
+// быстрые впереди, попадание в дальнем копируется в ближние.
+// Одинаковые одновременные вызовы ждут одного расчёта
+type Memo struct {
+	name   string
+	stores []Store
+
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+func NewMemo(name string, stores ...Store) *Memo {
+	return &Memo{name: name, stores: stores, flights: map[string]*flight{}}
+}
+
+// key учитывает соль: с другой солью это другая подпись
+func (m *Memo) key(data string) string {
+	return m.name + "\x00" + DataSignerSalt + "\x00" + data
+}
+
+func (m *Memo) lookup(key string) (string, bool) {
+	for i, store := range m.stores {
+		if val, ok := store.Get(key); ok {
+			for _, near := range m.stores[:i] {
+				near.Set(key, val)
+			}
+			return val, true
+		}
+	}
+	return "", false
+}
+
+func (m *Memo) Call(data string, fn func(string) string) string {
+	key := m.key(data)
+	if val, ok := m.lookup(key); ok {
+		return val
+	}
+
+	m.mu.Lock()
+	if f, ok := m.flights[key]; ok {
+		m.mu.Unlock()
+		<-f.done
+		return f.val
+	}
+	f := &flight{done: make(chan struct{})}
+	m.flights[key] = f
+	m.mu.Unlock()
+
+	f.val = fn(data)
+	for _, store := range m.stores {
+		store.Set(key, f.val)
+	}
+
+	m.mu.Lock()
+	delete(m.flights, key)
+	m.mu.Unlock()
+	close(f.done)
+	return f.val
+}
+
+// Wrap возвращает fn с запоминанием
+func (m *Memo) Wrap(fn func(string) string) func(string) string {
+	return func(data string) string {
+		return m.Call(data, fn)
+	}
+}
+
+// SignerCache - кеши для обоих сигнаторов, подключается через SignerConfig
+type SignerCache struct {
+	Crc32 *Memo
+	Md5   *Memo
+}
+
+func NewSignerCache(stores ...Store) *SignerCache {
+	return &SignerCache{
+		Crc32: NewMemo("crc32", stores...),
+		Md5:   NewMemo("md5", stores...),
+	}
+}
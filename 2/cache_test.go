@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	lru := NewLRU(2, 20*time.Millisecond)
+	lru.Set("a", "1")
+	lru.Set("b", "2")
+	lru.Get("a")
+	lru.Set("c", "3")
+
+	if _, ok := lru.Get("b"); ok {
+		t.Errorf("least recently used key not evicted")
+	}
+	if val, ok := lru.Get("a"); !ok || val != "1" {
+		t.Errorf("unexpected value for a: %q, %v", val, ok)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := lru.Get("c"); ok {
+		t.Errorf("expired key returned")
+	}
+}
+
+func TestMemo(t *testing.T) {
+	disk, err := NewDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls uint32
+	upper := func(data string) string {
+		atomic.AddUint32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return strings.ToUpper(data)
+	}
+
+	// одновременные одинаковые вызовы считаются один раз
+	memo := NewMemo("upper", NewLRU(10, 0), disk)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res := memo.Call("abc", upper); res != "ABC" {
+				t.Errorf("unexpected result: %q", res)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// новый Memo на том же каталоге берёт результат с диска
+	if res := NewMemo("upper", NewLRU(10, 0), disk).Call("abc", upper); res != "ABC" {
+		t.Errorf("unexpected result: %q", res)
+	}
+	if calls != 1 {
+		t.Errorf("function called %d times, expected 1", calls)
+	}
+
+	// другая соль - другой ключ
+	DataSignerSalt = "salt"
+	defer func() { DataSignerSalt = "" }()
+	memo.Call("abc", upper)
+	if calls != 2 {
+		t.Errorf("salt is not part of the key")
+	}
+}
+
+func TestSignerCache(t *testing.T) {
+	cfg := DefaultSignerConfig
+	cfg.Cache = NewSignerCache(NewLRU(100, time.Minute))
+	signer := NewSigner(cfg)
+
+	expected := "29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542"
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		res := Run(signer, "0", "1")
+		end := time.Since(start)
+
+		if len(res) != 1 || res[0] != expected {
+			t.Errorf("results not match\nGot: %v\nExpected: %v", res, expected)
+		}
+		if i == 1 && end > 100*time.Millisecond {
+			t.Errorf("cached run too long: %s", end)
+		}
+	}
+}
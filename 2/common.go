@@ -20,26 +20,58 @@ var (
 	DataSignerSalt            = ""
 )
 
+// OverheatError - сигнатор занят: вызов пришёл, пока не закончился предыдущий
+type OverheatError struct {
+	Op string // lock, unlock или md5 - перегрев во время расчёта подписи
+}
+
+func (e *OverheatError) Error() string {
+	return "data signer overheat on " + e.Op
+}
+
+var overheatCount uint64
+
+// OverheatCount - сколько раз сигнатор перегревался с начала работы
+func OverheatCount() uint64 {
+	return atomic.LoadUint64(&overheatCount)
+}
+
+// overheatSwap переключает флаг занятости, при неудаче засчитывает перегрев
+func overheatSwap(op string, from, to uint32) error {
+	if atomic.CompareAndSwapUint32(&dataSignerOverheat, from, to) {
+		return nil
+	}
+	atomic.AddUint64(&overheatCount, 1)
+	return &OverheatError{Op: op}
+}
+
+// TryOverheatLock занимает сигнатор без ожидания
+func TryOverheatLock() error {
+	return overheatSwap("lock", 0, 1)
+}
+
+// maxOverheatWait - дольше этого OverheatLock между попытками не спит
+const maxOverheatWait = 50 * time.Millisecond
+
+// OverheatLock ждёт, пока сигнатор освободится. Перегрев засчитывается
+// один раз на вызов, повторные попытки - с растущей паузой
 var OverheatLock = func() {
-	for {
-		if swapped := atomic.CompareAndSwapUint32(&dataSignerOverheat, 0, 1); !swapped {
-			fmt.Println("OverheatLock happend")
-			time.Sleep(time.Second)
-		} else {
-			break
+	if TryOverheatLock() == nil {
+		return
+	}
+	wait := time.Millisecond
+	for !atomic.CompareAndSwapUint32(&dataSignerOverheat, 0, 1) {
+		time.Sleep(wait)
+		if wait < maxOverheatWait {
+			wait *= 2
 		}
 	}
 }
 
+// OverheatUnlock освобождает сигнатор. Если он не был занят, ждать нечего -
+// это только засчитывается как перегрев
 var OverheatUnlock = func() {
-	for {
-		if swapped := atomic.CompareAndSwapUint32(&dataSignerOverheat, 1, 0); !swapped {
-			fmt.Println("OverheatUnlock happend")
-			time.Sleep(time.Second)
-		} else {
-			break
-		}
-	}
+	overheatSwap("unlock", 1, 0)
 }
 
 var DataSignerMd5 = func(data string) string {
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type graphEdge struct {
+	to   string
+	pred func(interface{}) bool // nil - пропускать всё
+}
+
+type graphNode struct {
+	task job
+	outs []graphEdge
+}
+
+// Graph - конвейер в виде DAG. Выход стадии копируется во все исходящие
+// рёбра, чей предикат его пропускает; вход с несколькими рёбрами сливается.
+// Стадии без входящих рёбер - источники, их вход сразу закрыт
+type Graph struct {
+	nodes map[string]*graphNode
+	order []string
+	err   error
+}
+
+func NewGraph() *Graph {
+	return &Graph{nodes: map[string]*graphNode{}}
+}
+
+func (g *Graph) fail(format string, args ...interface{}) *Graph {
+	if g.err == nil {
+		g.err = fmt.Errorf(format, args...)
+	}
+	return g
+}
+
+// Add добавляет стадию; имена должны быть уникальны
+func (g *Graph) Add(name string, task job) *Graph {
+	if _, ok := g.nodes[name]; ok {
+		return g.fail("graph: duplicate stage %q", name)
+	}
+	g.nodes[name] = &graphNode{task: task}
+	g.order = append(g.order, name)
+	return g
+}
+
+// Connect отдаёт весь выход from на вход to
+func (g *Graph) Connect(from, to string) *Graph {
+	return g.Route(from, to, nil)
+}
+
+// Route отдаёт на вход to только значения, для которых pred вернул true
+func (g *Graph) Route(from, to string, pred func(interface{}) bool) *Graph {
+	node, ok := g.nodes[from]
+	if !ok {
+		return g.fail("graph: unknown stage %q", from)
+	}
+	if _, ok := g.nodes[to]; !ok {
+		return g.fail("graph: unknown stage %q", to)
+	}
+	node.outs = append(node.outs, graphEdge{to, pred})
+	return g
+}
+
+// Build проверяет граф: ошибки при описании и циклы
+func (g *Graph) Build() error {
+	if g.err != nil {
+		return g.err
+	}
+
+	const (
+		unvisited = iota
+		inPath
+		finished
+	)
+	state := map[string]int{}
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case inPath:
+			idx := 0
+			for path[idx] != name {
+				idx++
+			}
+			return fmt.Errorf("graph: cycle %s -> %s", strings.Join(path[idx:], " -> "), name)
+		case finished:
+			return nil
+		}
+		state[name] = inPath
+		path = append(path, name)
+		for _, edge := range g.nodes[name].outs {
+			if err := visit(edge.to); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = finished
+		return nil
+	}
+
+	names := append([]string(nil), g.order...)
+	sort.Strings(names)
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run выполняет граф и ждёт, пока отработают все стадии.
+// Вход стадии закрывается, когда закончили все её производители
+func (g *Graph) Run() error {
+	if err := g.Build(); err != nil {
+		return err
+	}
+
+	ins := map[string]chan interface{}{}
+	producers := map[string]int{}
+	for _, name := range g.order {
+		ins[name] = make(chan interface{})
+		for _, edge := range g.nodes[name].outs {
+			producers[edge.to]++
+		}
+	}
+
+	mu := &sync.Mutex{}
+	// done - производитель закончил писать в to
+	done := func(to string) {
+		mu.Lock()
+		defer mu.Unlock()
+		producers[to]--
+		if producers[to] == 0 {
+			close(ins[to])
+		}
+	}
+	for _, name := range g.order {
+		if producers[name] == 0 {
+			close(ins[name])
+		}
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2 * len(g.order))
+	for _, name := range g.order {
+		go func(node *graphNode, in chan interface{}) {
+			defer wg.Done()
+			out := make(chan interface{})
+			go func() {
+				defer wg.Done()
+				node.task(in, out)
+				close(out)
+				drain(in)
+			}()
+
+			for val := range out {
+				for _, edge := range node.outs {
+					if edge.pred == nil || edge.pred(val) {
+						ins[edge.to] <- val
+					}
+				}
+			}
+			for _, edge := range node.outs {
+				done(edge.to)
+			}
+		}(g.nodes[name], ins[name])
+	}
+
+	wg.Wait()
+	return nil
+}
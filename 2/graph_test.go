@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestGraph(t *testing.T) {
+	mu := &sync.Mutex{}
+	got := map[string][]int{}
+	collect := func(name string) job {
+		return func(in, out chan interface{}) {
+			for val := range in {
+				mu.Lock()
+				got[name] = append(got[name], val.(int))
+				mu.Unlock()
+			}
+		}
+	}
+	numbers := func(from, to int) job {
+		return func(in, out chan interface{}) {
+			for i := from; i <= to; i++ {
+				out <- i
+			}
+		}
+	}
+	square := func(in, out chan interface{}) {
+		for val := range in {
+			out <- val.(int) * val.(int)
+		}
+	}
+	isEven := func(val interface{}) bool {
+		return val.(int)%2 == 0
+	}
+
+	// два источника сливаются в square, его выход идёт всем и по чётности
+	err := NewGraph().
+		Add("low", numbers(1, 3)).
+		Add("high", numbers(4, 5)).
+		Add("square", square).
+		Add("all", collect("all")).
+		Add("even", collect("even")).
+		Add("odd", collect("odd")).
+		Connect("low", "square").
+		Connect("high", "square").
+		Connect("square", "all").
+		Route("square", "even", isEven).
+		Route("square", "odd", func(val interface{}) bool { return !isEven(val) }).
+		Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"all": "[1 4 9 16 25]", "even": "[4 16]", "odd": "[1 9 25]"}
+	for name, exp := range expected {
+		sort.Ints(got[name])
+		if res := fmt.Sprint(got[name]); res != exp {
+			t.Errorf("%s: got %s, expected %s", name, res, exp)
+		}
+	}
+}
+
+func TestGraphErrors(t *testing.T) {
+	pass := func(in, out chan interface{}) {
+		for val := range in {
+			out <- val
+		}
+	}
+
+	cases := []struct {
+		graph *Graph
+		err   string
+	}{
+		{NewGraph().Add("a", pass).Add("a", pass), `graph: duplicate stage "a"`},
+		{NewGraph().Add("a", pass).Connect("a", "b"), `graph: unknown stage "b"`},
+		{
+			NewGraph().Add("a", pass).Add("b", pass).Add("c", pass).
+				Connect("a", "b").Connect("b", "c").Connect("c", "b"),
+			"graph: cycle b -> c -> b",
+		},
+	}
+	for _, c := range cases {
+		if err := c.graph.Run(); err == nil || err.Error() != c.err {
+			t.Errorf("got error %v, expected %q", err, c.err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LimiterConfig - квота на вызовы сигнатора. Нулевые значения - без ограничения
+type LimiterConfig struct {
+	Rate        float64 // вызовов в секунду в среднем
+	Burst       int     // сколько вызовов можно сделать разом после простоя
+	MaxInFlight int     // сколько вызовов может выполняться одновременно
+}
+
+// Limiter - token bucket плюс семафор на одновременные вызовы
+type Limiter struct {
+	rate  float64
+	burst float64
+	slots chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(cfg LimiterConfig) *Limiter {
+	l := &Limiter{rate: cfg.Rate, burst: float64(cfg.Burst)}
+	if l.burst < 1 {
+		l.burst = 1
+	}
+	l.tokens = l.burst
+	l.last = time.Now()
+	if cfg.MaxInFlight > 0 {
+		l.slots = make(chan struct{}, cfg.MaxInFlight)
+	}
+	return l
+}
+
+// reserve забирает токен и говорит, сколько ждать, пока он станет действительным
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// cancel возвращает токен, которым так и не воспользовались
+func (l *Limiter) cancel() {
+	l.mu.Lock()
+	l.tokens++
+	l.mu.Unlock()
+}
+
+// Acquire ждёт токен и свободный слот. После успеха нужен Release
+func (l *Limiter) Acquire(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if l.rate > 0 {
+		if wait := l.reserve(); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				l.cancel()
+				return ctx.Err()
+			}
+		}
+	}
+
+	if l.slots == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *Limiter) Release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// Do выполняет fn в пределах квоты
+func (l *Limiter) Do(ctx context.Context, fn func()) error {
+	if err := l.Acquire(ctx); err != nil {
+		return err
+	}
+	defer l.Release()
+	fn()
+	return nil
+}
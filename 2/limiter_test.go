@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiterInFlight(t *testing.T) {
+	lim := NewLimiter(LimiterConfig{MaxInFlight: 2})
+	var cur, peak int32
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lim.Do(context.Background(), func() {
+				n := atomic.AddInt32(&cur, 1)
+				for {
+					old := atomic.LoadInt32(&peak)
+					if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				atomic.AddInt32(&cur, -1)
+			})
+		}()
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Errorf("%d calls at once, limit is 2", peak)
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	lim := NewLimiter(LimiterConfig{Rate: 100, Burst: 2})
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := lim.Acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		lim.Release()
+	}
+	// два вызова из запаса, остальные четыре - по 10ms
+	if end := time.Since(start); end < 35*time.Millisecond {
+		t.Errorf("rate not limited: 6 calls in %s", end)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := lim.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestOverheatError(t *testing.T) {
+	before := OverheatCount()
+	if err := TryOverheatLock(); err != nil {
+		t.Fatal(err)
+	}
+	defer OverheatUnlock()
+
+	var overheat *OverheatError
+	if err := TryOverheatLock(); !errors.As(err, &overheat) || overheat.Op != "lock" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if OverheatCount() != before+1 {
+		t.Errorf("overheat not counted")
+	}
+}
+
+// fastSigners подменяет сигнаторы быстрыми, md5 сам проверяет перегрев
+func fastSigners(t *testing.T, md5Delay time.Duration) *int32 {
+	crc32, md5 := DataSignerCrc32, DataSignerMd5
+	t.Cleanup(func() {
+		DataSignerCrc32, DataSignerMd5 = crc32, md5
+	})
+
+	var peak, cur int32
+	DataSignerCrc32 = func(data string) string {
+		return data
+	}
+	DataSignerMd5 = func(data string) string {
+		n := atomic.AddInt32(&cur, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+				break
+			}
+		}
+		defer atomic.AddInt32(&cur, -1)
+		for TryOverheatLock() != nil {
+			time.Sleep(time.Millisecond)
+		}
+		defer overheatSwap("unlock", 1, 0)
+		time.Sleep(md5Delay)
+		return data
+	}
+	return &peak
+}
+
+func TestSignerSharedLimiter(t *testing.T) {
+	peak := fastSigners(t, 2*time.Millisecond)
+	before := OverheatCount()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Run(NewSigner(DefaultSignerConfig), "0", "1", "2", "3", "4")
+		}()
+	}
+	wg.Wait()
+
+	if *peak != 1 || OverheatCount() != before {
+		t.Errorf("%d md5 calls at once, %d overheats", *peak, OverheatCount()-before)
+	}
+}
+
+func TestSignerOverheat(t *testing.T) {
+	fastSigners(t, 0)
+
+	var errs []error
+	mu := &sync.Mutex{}
+	cfg := DefaultSignerConfig
+	cfg.OnError = func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+
+	// сигнатор занят вызовом в обход квоты
+	if err := TryOverheatLock(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		OverheatUnlock()
+	}()
+	Run(NewSigner(cfg), "1")
+
+	var overheat *OverheatError
+	if len(errs) != 1 || !errors.As(errs[0], &overheat) || overheat.Op != "md5" {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
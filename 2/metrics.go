@@ -0,0 +1,393 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBounds - верхние границы корзин гистограммы задержек
+var latencyBounds = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// HistogramSnapshot - Counts[i] значений не больше Bounds[i], последняя корзина - всё остальное
+type HistogramSnapshot struct {
+	Bounds []time.Duration
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+// StageSnapshot - состояние одной стадии на момент снимка
+type StageSnapshot struct {
+	Index    int
+	Name     string
+	In       uint64 // сколько значений стадия прочитала из очереди
+	Out      uint64 // сколько стадия отдала
+	Queue    int    // сколько значений ждёт в очереди на входе
+	QueueMax int    // наибольший Queue
+	Latency  HistogramSnapshot
+}
+
+type stageStats struct {
+	mu       sync.Mutex
+	snap     StageSnapshot
+	lastRead time.Time
+	lastSent time.Time
+}
+
+func newStageStats(index int, name string) *stageStats {
+	return &stageStats{snap: StageSnapshot{
+		Index: index,
+		Name:  name,
+		Latency: HistogramSnapshot{
+			Bounds: latencyBounds,
+			Counts: make([]uint64, len(latencyBounds)+1),
+		},
+	}}
+}
+
+// start - новый запуск стадии, задержка первого выхода считается от него
+func (s *stageStats) start() {
+	s.mu.Lock()
+	s.lastSent = time.Now()
+	s.lastRead = time.Time{}
+	s.mu.Unlock()
+}
+
+// queued - в очереди на входе стало depth значений
+func (s *stageStats) queued(depth int) {
+	s.mu.Lock()
+	s.snap.Queue = depth
+	if depth > s.snap.QueueMax {
+		s.snap.QueueMax = depth
+	}
+	s.mu.Unlock()
+}
+
+// read - стадия забрала значение, в очереди осталось depth
+func (s *stageStats) read(depth int) {
+	s.mu.Lock()
+	s.snap.In++
+	s.snap.Queue = depth
+	s.lastRead = time.Now()
+	s.mu.Unlock()
+}
+
+// sent - задержка считается от последнего чтения входа или от прошлого
+// выхода, если он был позже: это время работы самой стадии, ожидание в
+// её очереди не входит, а ожидание места в очереди следующей - входит.
+// Так стадии, которые фильтруют, собирают или переставляют значения,
+// не выглядят медленнее, чем есть
+func (s *stageStats) sent() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	from := s.lastSent
+	if s.lastRead.After(from) {
+		from = s.lastRead
+	}
+	s.lastSent = now
+	s.snap.Out++
+
+	latency := now.Sub(from)
+	hist := &s.snap.Latency
+	idx := len(hist.Bounds)
+	for i, bound := range hist.Bounds {
+		if latency <= bound {
+			idx = i
+			break
+		}
+	}
+	hist.Counts[idx]++
+	hist.Count++
+	hist.Sum += latency
+}
+
+func (s *stageStats) snapshot() StageSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := s.snap
+	snap.Latency.Counts = append([]uint64(nil), s.snap.Latency.Counts...)
+	return snap
+}
+
+// Metrics собирает статистику стадий, обёрнутых через Instrument.
+// Повторные запуски тех же стадий накапливаются
+type Metrics struct {
+	mu        sync.Mutex
+	queueSize int
+	stages    map[string]*stageStats
+	order     []*stageStats
+}
+
+// NewMetrics - метрики, у которых между стадиями очередь на queueSize значений
+func NewMetrics(queueSize int) *Metrics {
+	return &Metrics{queueSize: queueSize, stages: map[string]*stageStats{}}
+}
+
+func jobName(j job) string {
+	name := runtime.FuncForPC(reflect.ValueOf(j).Pointer()).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	if idx := strings.Index(name, "."); idx >= 0 {
+		name = name[idx+1:]
+	}
+	return name
+}
+
+func (m *Metrics) stage(index int, name string) *stageStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := fmt.Sprint(index, "/", name)
+	if s, ok := m.stages[key]; ok {
+		return s
+	}
+	s := newStageStats(index, name)
+	m.stages[key] = s
+	m.order = append(m.order, s)
+	return s
+}
+
+// stageQueue - очередь между соседними стадиями. В неё пишет только
+// предыдущая стадия, а читает только следующая
+type stageQueue struct {
+	mu     sync.Mutex
+	items  []interface{}
+	limit  int
+	closed bool
+	pushed chan struct{} // появилось значение или очередь закрыли
+	popped chan struct{} // освободилось место
+}
+
+func newStageQueue(limit int) *stageQueue {
+	if limit < 1 {
+		limit = 1
+	}
+	return &stageQueue{
+		limit:  limit,
+		pushed: make(chan struct{}, 1),
+		popped: make(chan struct{}, 1),
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (q *stageQueue) push(val interface{}) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, val)
+	signal(q.pushed)
+	return len(q.items)
+}
+
+func (q *stageQueue) pop() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items[0] = nil
+	q.items = q.items[1:]
+	signal(q.popped)
+	return len(q.items)
+}
+
+// head - первое значение; ok == false, если очередь пуста
+func (q *stageQueue) head() (val interface{}, ok, closed bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return nil, false, q.closed
+	}
+	return q.items[0], true, q.closed
+}
+
+func (q *stageQueue) full() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items) >= q.limit
+}
+
+func (q *stageQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	signal(q.pushed)
+	q.mu.Unlock()
+}
+
+// Instrument оборачивает стадии для ExecutePipeline, порядок и число не меняются.
+// Соседние стадии связываются напрямую через очередь на queueSize значений
+// (хотя бы на одно), каналы ExecutePipeline между ними не используются,
+// поэтому результат одного вызова запускается один раз и целиком
+func (m *Metrics) Instrument(tasks ...job) []job {
+	stats := make([]*stageStats, len(tasks)+1)
+	queues := make([]*stageQueue, len(tasks)+1)
+	for i, task := range tasks {
+		stats[i] = m.stage(i, jobName(task))
+		if i > 0 {
+			queues[i] = newStageQueue(m.queueSize)
+		}
+	}
+
+	res := make([]job, len(tasks))
+	for i, task := range tasks {
+		res[i] = wrap(task, stats[i], queues[i], stats[i+1], queues[i+1])
+	}
+	return res
+}
+
+// wrap запускает стадию на своих каналах и сам отдаёт ей значения из queue
+// и забирает её выход в очередь следующей стадии next. Чтения и записи стадии
+// замечает одна горутина, поэтому они видны в том порядке, в каком стадия их
+// делала. У первой и последней стадии остаются каналы ExecutePipeline
+func wrap(task job, s *stageStats, queue *stageQueue, next *stageStats, nextQueue *stageQueue) job {
+	return func(in, out chan interface{}) {
+		s.start()
+		var stageIn chan interface{}
+		if queue != nil {
+			stageIn = make(chan interface{})
+			in = stageIn
+		}
+		stageOut := make(chan interface{})
+		go func() {
+			task(in, stageOut)
+			close(stageOut)
+			drain(in)
+		}()
+
+		var held interface{}
+		holding := false
+		for stageIn != nil || stageOut != nil || holding {
+			var (
+				give, take, deliver chan interface{}
+				head                interface{}
+				pushed, popped      <-chan struct{}
+			)
+			if stageIn != nil {
+				val, ok, closed := queue.head()
+				switch {
+				case ok:
+					give, head = stageIn, val
+				case closed:
+					close(stageIn)
+					stageIn = nil
+					continue
+				default:
+					pushed = queue.pushed
+				}
+			}
+			// выход забирается, только когда его есть куда положить
+			switch {
+			case holding:
+				deliver = out
+			case stageOut == nil:
+			case nextQueue != nil && nextQueue.full():
+				popped = nextQueue.popped
+			default:
+				take = stageOut
+			}
+
+			select {
+			case give <- head:
+				s.read(queue.pop())
+			case val, ok := <-take:
+				if !ok {
+					stageOut = nil
+					if nextQueue != nil {
+						nextQueue.close()
+					}
+					continue
+				}
+				s.sent()
+				if nextQueue == nil {
+					held, holding = val, true
+					continue
+				}
+				next.queued(nextQueue.push(val))
+			case deliver <- held:
+				held, holding = nil, false
+			case <-pushed:
+			case <-popped:
+			}
+		}
+	}
+}
+
+// Snapshot - состояние всех стадий в порядке регистрации
+func (m *Metrics) Snapshot() []StageSnapshot {
+	m.mu.Lock()
+	stages := append([]*stageStats(nil), m.order...)
+	m.mu.Unlock()
+
+	res := make([]StageSnapshot, len(stages))
+	for i, s := range stages {
+		res[i] = s.snapshot()
+	}
+	return res
+}
+
+// WritePrometheus пишет снимок в текстовом формате Prometheus
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	snaps := m.Snapshot()
+	b := &strings.Builder{}
+
+	series := func(name, kind, help string, value func(s StageSnapshot) interface{}) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, s := range snaps {
+			fmt.Fprintf(b, "%s{stage=%q,index=\"%d\"} %v\n", name, s.Name, s.Index, value(s))
+		}
+	}
+	series("pipeline_items_in_total", "counter", "Items the stage read from its queue.",
+		func(s StageSnapshot) interface{} { return s.In })
+	series("pipeline_items_out_total", "counter", "Items emitted by the stage.",
+		func(s StageSnapshot) interface{} { return s.Out })
+	series("pipeline_queue_depth", "gauge", "Items waiting in the stage input queue.",
+		func(s StageSnapshot) interface{} { return s.Queue })
+	series("pipeline_queue_depth_max", "gauge", "Largest stage input queue depth.",
+		func(s StageSnapshot) interface{} { return s.QueueMax })
+
+	fmt.Fprintf(b, "# HELP data_signer_overheats_total Calls that found the data signer busy.\n"+
+		"# TYPE data_signer_overheats_total counter\ndata_signer_overheats_total %d\n", OverheatCount())
+
+	const hist = "pipeline_latency_seconds"
+	fmt.Fprintf(b, "# HELP %s Time from the last read or emit of the stage to its next emit.\n# TYPE %s histogram\n", hist, hist)
+	for _, s := range snaps {
+		labels := fmt.Sprintf("stage=%q,index=\"%d\"", s.Name, s.Index)
+		var total uint64
+		for i, bound := range s.Latency.Bounds {
+			total += s.Latency.Counts[i]
+			fmt.Fprintf(b, "%s_bucket{%s,le=\"%g\"} %d\n", hist, labels, bound.Seconds(), total)
+		}
+		fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", hist, labels, s.Latency.Count)
+		fmt.Fprintf(b, "%s_sum{%s} %g\n", hist, labels, s.Latency.Sum.Seconds())
+		fmt.Fprintf(b, "%s_count{%s} %d\n", hist, labels, s.Latency.Count)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP отдаёт метрики для Prometheus
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WritePrometheus(w)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics(2)
+	ExecutePipeline(metrics.Instrument(
+		job(func(in, out chan interface{}) {
+			for i := 0; i < 4; i++ {
+				out <- i
+			}
+		}),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				time.Sleep(20 * time.Millisecond)
+				out <- val
+			}
+		}),
+		job(func(in, out chan interface{}) {
+			for range in {
+			}
+		}),
+	)...)
+
+	snaps := metrics.Snapshot()
+	if len(snaps) != 3 {
+		t.Fatalf("got %d stages, expected 3", len(snaps))
+	}
+	slow := snaps[1]
+	if slow.In != 4 || slow.Out != 4 || snaps[2].In != 4 || snaps[2].Out != 0 {
+		t.Errorf("unexpected counts: %+v", snaps)
+	}
+	if slow.Latency.Count != 4 || slow.Latency.Sum < 80*time.Millisecond {
+		t.Errorf("unexpected latency: %+v", slow.Latency)
+	}
+	// пока медленная стадия спит над первым значением, два лежат в очереди
+	if slow.QueueMax != 2 || slow.Queue != 0 {
+		t.Errorf("unexpected queue depth: %d, max %d", slow.Queue, slow.QueueMax)
+	}
+	if !strings.HasPrefix(slow.Name, "TestMetrics.") {
+		t.Errorf("unexpected stage name: %q", slow.Name)
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Result().Body)
+	for _, line := range []string{
+		`pipeline_items_in_total{stage="` + slow.Name + `",index="1"} 4`,
+		`pipeline_latency_seconds_bucket{stage="` + slow.Name + `",index="1",le="0.01"} 0`,
+		`pipeline_latency_seconds_count{stage="` + slow.Name + `",index="1"} 4`,
+		fmt.Sprint("data_signer_overheats_total ", OverheatCount()),
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("no %q in output:\n%s", line, body)
+		}
+	}
+}
+
+func TestMetricsBackpressure(t *testing.T) {
+	var sent int32
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		ExecutePipeline(NewMetrics(0).Instrument(
+			job(func(in, out chan interface{}) {
+				for i := 0; i < 10; i++ {
+					out <- i
+					atomic.AddInt32(&sent, 1)
+				}
+			}),
+			job(func(in, out chan interface{}) {
+				<-release
+				for range in {
+				}
+			}),
+		)...)
+		close(done)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	// без очереди источник опережает стадию только на значение, которое ждёт её чтения
+	if n := atomic.LoadInt32(&sent); n != 1 {
+		t.Errorf("source sent %d values to a blocked stage", n)
+	}
+	close(release)
+	<-done
+}
+
+func TestMetricsFilter(t *testing.T) {
+	metrics := NewMetrics(4)
+	ExecutePipeline(metrics.Instrument(
+		job(func(in, out chan interface{}) {
+			for i := 0; i < 50; i++ {
+				time.Sleep(2 * time.Millisecond)
+				out <- i
+			}
+		}),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				if val.(int)%10 == 9 {
+					out <- val
+				}
+			}
+		}),
+		job(func(in, out chan interface{}) {
+			for range in {
+			}
+		}),
+	)...)
+
+	// фильтр сам ничего не ждёт: задержка - от последнего прочитанного
+	// значения, а не от первого, которое он отбросил
+	filter := metrics.Snapshot()[1]
+	if filter.In != 50 || filter.Out != 5 {
+		t.Errorf("unexpected counts: %+v", filter)
+	}
+	if filter.Latency.Count != 5 || filter.Latency.Counts[0] != 5 {
+		t.Errorf("filter latency is not under %v: %+v", latencyBounds[0], filter.Latency)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// ctxJob - стадия конвейера, которая видит отмену и может вернуть ошибку
+type ctxJob func(ctx context.Context, in, out chan interface{}) error
+
+// withContext позволяет использовать обычный job в ExecutePipelineContext.
+// Такой job не видит отмену, но не зависнет: его выход вычитывается до закрытия
+func withContext(j job) ctxJob {
+	return func(ctx context.Context, in, out chan interface{}) error {
+		j(in, out)
+		return nil
+	}
+}
+
+// drain дочитывает канал до закрытия: стадия могла выйти, не дочитав вход,
+// а тот, кто в него пишет, не должен зависнуть на отправке
+func drain[T any](ch <-chan T) {
+	for range ch {
+	}
+}
+
+// send отправляет значение дальше, если конвейер ещё не остановлен
+func send(ctx context.Context, out chan interface{}, value interface{}) error {
+	select {
+	case out <- value:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ExecutePipelineContext как ExecutePipeline, но первая ошибка стадии отменяет
+// контекст всех остальных и возвращается вызывающему, как в errgroup.
+// Вход первой стадии сразу закрыт
+func ExecutePipelineContext(ctx context.Context, tasks ...ctxJob) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chans := make([]chan interface{}, len(tasks)+1)
+	for i := range chans {
+		chans[i] = make(chan interface{})
+	}
+	close(chans[0])
+
+	var (
+		once     sync.Once
+		firstErr error
+	)
+	wg := &sync.WaitGroup{}
+	wg.Add(len(tasks))
+
+	for i := range tasks {
+		go func(itr int) {
+			defer wg.Done()
+			err := tasks[itr](ctx, chans[itr], chans[itr+1])
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+			close(chans[itr+1])
+			drain(chans[itr])
+		}(i)
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPipelineContextError(t *testing.T) {
+	errStage := errors.New("stage failed")
+	var produced, legacy uint32
+
+	jobs := []ctxJob{
+		// бесконечный источник, который уважает отмену
+		func(ctx context.Context, in, out chan interface{}) error {
+			for i := 0; ; i++ {
+				if err := send(ctx, out, i); err != nil {
+					return err
+				}
+				atomic.AddUint32(&produced, 1)
+			}
+		},
+		// старый job без контекста - не должен зависнуть на отправке
+		withContext(func(in, out chan interface{}) {
+			for val := range in {
+				out <- val
+				atomic.AddUint32(&legacy, 1)
+			}
+		}),
+		func(ctx context.Context, in, out chan interface{}) error {
+			for val := range in {
+				if val.(int) == 3 {
+					return errStage
+				}
+			}
+			return nil
+		},
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- ExecutePipelineContext(context.Background(), jobs...)
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, errStage) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("pipeline did not stop after stage error")
+	}
+
+	if atomic.LoadUint32(&legacy) < 3 {
+		t.Errorf("legacy stage got %d values, expected at least 3", legacy)
+	}
+}
+
+func TestPipelineContextCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var recieved uint32
+	err := ExecutePipelineContext(ctx,
+		func(ctx context.Context, in, out chan interface{}) error {
+			for {
+				if err := send(ctx, out, 1); err != nil {
+					return err
+				}
+				time.Sleep(time.Millisecond)
+			}
+		},
+		func(ctx context.Context, in, out chan interface{}) error {
+			for range in {
+				atomic.AddUint32(&recieved, 1)
+			}
+			return nil
+		},
+	)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if recieved == 0 {
+		t.Errorf("no values passed before cancel")
+	}
+}
+
+func TestPipelineContextSigner(t *testing.T) {
+	var result string
+	err := ExecutePipelineContext(context.Background(),
+		func(ctx context.Context, in, out chan interface{}) error {
+			for _, num := range []int{0, 1} {
+				if err := send(ctx, out, num); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		withContext(SingleHash),
+		withContext(MultiHash),
+		withContext(CombineResults),
+		func(ctx context.Context, in, out chan interface{}) error {
+			result = (<-in).(string)
+			return nil
+		},
+	)
+
+	expected := "29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542"
+	if err != nil || result != expected {
+		t.Errorf("results not match\nGot: %v (%v)\nExpected: %v", result, err, expected)
+	}
+}
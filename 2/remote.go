@@ -0,0 +1,558 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// remotePoll - сколько сервер держит запрос результатов, если новых нет
+	remotePoll = time.Second
+	// remoteIdle - через сколько сервер забывает сессию, к которой никто не ходит
+	remoteIdle = time.Minute
+)
+
+var errSessionClosed = errors.New("session closed")
+
+// Codec переводит значения стадии в JSON для передачи по сети и обратно.
+// Decode должен вернуть значение того типа, которого ждёт принимающая сторона
+type Codec interface {
+	Encode(v interface{}) (json.RawMessage, error)
+	Decode(data json.RawMessage) (interface{}, error)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(v interface{}) (json.RawMessage, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Decode(data json.RawMessage) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	return v, err
+}
+
+// JSONCodec - кодек по умолчанию: исходный тип теряется, числа приходят как
+// json.Number, объекты - как map[string]interface{}
+var JSONCodec Codec = jsonCodec{}
+
+type typedCodec[T any] struct{}
+
+func (typedCodec[T]) Encode(v interface{}) (json.RawMessage, error) {
+	if _, ok := v.(T); !ok {
+		var want T
+		return nil, fmt.Errorf("remote stage: value of type %T, expected %T", v, want)
+	}
+	return json.Marshal(v)
+}
+
+func (typedCodec[T]) Decode(data json.RawMessage) (interface{}, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// TypedCodec - значения одного типа T, на другой стороне получается тоже T
+func TypedCodec[T any]() Codec {
+	return typedCodec[T]{}
+}
+
+// RemoteCodecs - как передаются вход и выход удалённой стадии; у клиента
+// и сервера должны совпадать. nil - JSONCodec
+type RemoteCodecs struct {
+	In  Codec
+	Out Codec
+}
+
+func (c RemoteCodecs) in() Codec {
+	if c.In != nil {
+		return c.In
+	}
+	return JSONCodec
+}
+
+func (c RemoteCodecs) out() Codec {
+	if c.Out != nil {
+		return c.Out
+	}
+	return JSONCodec
+}
+
+// remoteItem - одно входное значение; seq нужен, чтобы повтор не попал дважды
+type remoteItem struct {
+	Seq   int             `json:"seq"`
+	Value json.RawMessage `json:"value"`
+}
+
+// remoteResults - результаты с номера From; запрос с from=N подтверждает всё до N
+type remoteResults struct {
+	From    int               `json:"from"`
+	Results []json.RawMessage `json:"results"`
+	Done    bool              `json:"done"`
+}
+
+type remoteSession struct {
+	id   string
+	in   chan interface{}
+	stop chan struct{} // закрывается, когда сессию забыли
+	once sync.Once
+
+	// active и idle меняются под RemoteServer.mu: пока идут запросы,
+	// таймер простоя стоит
+	active int
+	idle   *time.Timer
+
+	pushMu sync.Mutex // значения уходят в job строго по одному и по порядку
+	next   int
+	closed bool
+
+	mu      sync.Mutex
+	base    int // номер первого неподтверждённого результата
+	results []json.RawMessage
+	done    bool
+	err     error         // результат не закодировался, дальше отдавать нечего
+	changed chan struct{} // закрывается при каждом изменении results или done
+}
+
+func (s *remoteSession) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *remoteSession) run(j job, codec Codec) {
+	out := make(chan interface{})
+	go func() {
+		j(s.in, out)
+		close(out)
+		drain(s.in)
+	}()
+
+	for val := range out {
+		select {
+		case <-s.stop:
+			continue // результаты забытой сессии никто не заберёт
+		default:
+		}
+		data, err := codec.Encode(val)
+		s.mu.Lock()
+		switch {
+		case s.err != nil:
+		case err != nil:
+			s.err = err
+		default:
+			s.results = append(s.results, data)
+		}
+		s.notify()
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	s.done = true
+	s.notify()
+	s.mu.Unlock()
+}
+
+// push идемпотентен: уже принятый seq просто подтверждается ещё раз
+func (s *remoteSession) push(ctx context.Context, seq int, val interface{}) error {
+	s.pushMu.Lock()
+	defer s.pushMu.Unlock()
+
+	switch {
+	case seq < s.next:
+		return nil
+	case seq > s.next:
+		return fmt.Errorf("expected item %d, got %d", s.next, seq)
+	case s.closed:
+		return errors.New("input already closed")
+	}
+	select {
+	case s.in <- val:
+	case <-s.stop:
+		return errSessionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	s.next++
+	return nil
+}
+
+func (s *remoteSession) close() {
+	s.pushMu.Lock()
+	defer s.pushMu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.in)
+	}
+}
+
+// shutdown - сессию забыли: ждущие запросы отпускаются, вход закрывается
+func (s *remoteSession) shutdown() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	s.close()
+}
+
+// fetch отдаёт результаты начиная с from, а всё до from забывает
+func (s *remoteSession) fetch(ctx context.Context, from int) (remoteResults, error) {
+	timer := time.NewTimer(remotePoll)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		if from < s.base || from > s.base+len(s.results) {
+			s.mu.Unlock()
+			return remoteResults{}, fmt.Errorf("results from %d are not available", from)
+		}
+		s.results = s.results[from-s.base:]
+		s.base = from
+		res := remoteResults{From: from, Results: s.results, Done: s.done}
+		changed, err := s.changed, s.err
+		s.mu.Unlock()
+
+		if len(res.Results) == 0 && err != nil {
+			return res, err
+		}
+		if len(res.Results) > 0 || res.Done {
+			return res, nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return res, nil
+		case <-s.stop:
+			return res, errSessionClosed
+		case <-ctx.Done():
+			return res, ctx.Err()
+		}
+	}
+}
+
+// RemoteServer выполняет job для удалённых клиентов, каждый запуск - отдельная сессия:
+//
+//	PUT  /{id}           - новая сессия, id выбирает клиент, повтор ничего не меняет
+//	POST /{id}/items     - очередное значение {"seq": N, "value": ...}
+//	POST /{id}/close     - вход закончился
+//	GET  /{id}/results?from=N
+//	DELETE /{id}         - клиент закончил, сессию можно забыть
+//
+// Сессия, к которой дольше IdleTimeout не было запросов (клиент упал),
+// закрывается и забывается так же, как по DELETE. Значения передаются
+// через Codecs, по умолчанию как JSON без исходных типов
+type RemoteServer struct {
+	job job
+	// задаются до начала работы
+	IdleTimeout time.Duration // 0 - remoteIdle
+	Codecs      RemoteCodecs
+
+	mu       sync.Mutex
+	sessions map[string]*remoteSession
+}
+
+func NewRemoteServer(j job) *RemoteServer {
+	return &RemoteServer{job: j, sessions: map[string]*remoteSession{}}
+}
+
+func (srv *RemoteServer) idleTimeout() time.Duration {
+	if srv.IdleTimeout > 0 {
+		return srv.IdleTimeout
+	}
+	return remoteIdle
+}
+
+// open создаёт сессию, если её ещё нет, и отмечает запрос к ней
+func (srv *RemoteServer) open(id string) *remoteSession {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	s, ok := srv.sessions[id]
+	if !ok {
+		s = &remoteSession{id: id, in: make(chan interface{}), stop: make(chan struct{}), changed: make(chan struct{})}
+		s.idle = time.AfterFunc(srv.idleTimeout(), func() {
+			srv.expire(s)
+		})
+		srv.sessions[id] = s
+		go s.run(srv.job, srv.Codecs.out())
+	}
+	s.active++
+	s.idle.Stop()
+	return s
+}
+
+// acquire отмечает запрос к сессии, nil - такой нет
+func (srv *RemoteServer) acquire(id string) *remoteSession {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	s := srv.sessions[id]
+	if s != nil {
+		s.active++
+		s.idle.Stop()
+	}
+	return s
+}
+
+// release - запрос закончился; с последним запускается таймер простоя
+func (srv *RemoteServer) release(s *remoteSession) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	s.active--
+	if s.active == 0 && srv.sessions[s.id] == s {
+		s.idle.Reset(srv.idleTimeout())
+	}
+}
+
+// expire забывает сессию, если за время таймера к ней так и не пришли
+func (srv *RemoteServer) expire(s *remoteSession) {
+	srv.mu.Lock()
+	if s.active > 0 || srv.sessions[s.id] != s {
+		srv.mu.Unlock()
+		return
+	}
+	delete(srv.sessions, s.id)
+	srv.mu.Unlock()
+	s.shutdown()
+}
+
+func (srv *RemoteServer) remove(s *remoteSession) {
+	srv.mu.Lock()
+	if srv.sessions[s.id] == s {
+		delete(srv.sessions, s.id)
+	}
+	srv.mu.Unlock()
+	s.shutdown()
+}
+
+func (srv *RemoteServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	if len(parts) == 1 && r.Method == http.MethodPut {
+		srv.release(srv.open(parts[0]))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	s := srv.acquire(parts[0])
+	if s == nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer srv.release(s)
+	if len(parts) == 1 && r.Method == http.MethodDelete {
+		srv.remove(s)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case parts[1] == "items" && r.Method == http.MethodPost:
+		var item remoteItem
+		if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		val, err := srv.Codecs.in().Decode(item.Value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.push(r.Context(), item.Seq, val); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		json.NewEncoder(w).Encode(item.Seq)
+
+	case parts[1] == "close" && r.Method == http.MethodPost:
+		s.close()
+		w.WriteHeader(http.StatusNoContent)
+
+	case parts[1] == "results" && r.Method == http.MethodGet:
+		from, err := strconv.Atoi(r.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		res, err := s.fetch(r.Context(), from)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		json.NewEncoder(w).Encode(res)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// RemoteOptions - как клиент ходит к RemoteServer
+type RemoteOptions struct {
+	Client  *http.Client // nil - http.DefaultClient
+	Retries int          // повторов на каждый запрос после неудачи
+	Backoff time.Duration
+	Codecs  RemoteCodecs // те же, что у сервера
+}
+
+type remoteClient struct {
+	url  string
+	opts RemoteOptions
+}
+
+// remoteError - сервер ответил ошибкой
+type remoteError struct {
+	status int
+	msg    string
+}
+
+func (e *remoteError) Error() string {
+	return fmt.Sprintf("remote stage: %d %s", e.status, e.msg)
+}
+
+// call делает запрос с повторами, ответ декодируется в res
+func (c *remoteClient) call(ctx context.Context, method, path string, body, res interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	client := c.opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var err error
+	for try := 0; try <= c.opts.Retries; try++ {
+		if try > 0 {
+			select {
+			case <-time.After(c.opts.Backoff << (try - 1)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, method, c.url+path, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		var resp *http.Response
+		resp, err = client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		data, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		switch {
+		case readErr != nil:
+			err = readErr
+		case resp.StatusCode >= 500:
+			err = &remoteError{resp.StatusCode, strings.TrimSpace(string(data))}
+		case resp.StatusCode >= 300:
+			return &remoteError{resp.StatusCode, strings.TrimSpace(string(data))}
+		case res == nil:
+			return nil
+		default:
+			return json.Unmarshal(data, res)
+		}
+	}
+	return err
+}
+
+// forget удаляет сессию на сервере; 404 значит, что её уже удалил прошлый повтор
+func (c *remoteClient) forget(base string) {
+	ctx, cancel := context.WithTimeout(context.Background(), remotePoll)
+	defer cancel()
+	c.call(ctx, http.MethodDelete, base, nil, nil)
+}
+
+// RemoteStage отправляет вход стадии на RemoteServer по url и отдаёт его результаты.
+// Значения уходят по одному, следующее - только после подтверждения предыдущего.
+// Без opts.Codecs значения передаются как JSON и приходят без исходных типов
+func RemoteStage(url string, opts RemoteOptions) ctxJob {
+	c := &remoteClient{url: strings.TrimRight(url, "/"), opts: opts}
+	return func(ctx context.Context, in, out chan interface{}) error {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		base := "/" + hex.EncodeToString(id)
+		if err := c.call(ctx, http.MethodPut, base, nil, nil); err != nil {
+			return err
+		}
+		defer c.forget(base)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		sendErr := make(chan error, 1)
+		go func() {
+			seq := 0
+			for val := range in {
+				data, err := opts.Codecs.in().Encode(val)
+				if err == nil {
+					err = c.call(ctx, http.MethodPost, base+"/items", remoteItem{seq, data}, nil)
+				}
+				if err != nil {
+					sendErr <- err
+					cancel()
+					return
+				}
+				seq++
+			}
+			sendErr <- c.call(ctx, http.MethodPost, base+"/close", nil, nil)
+		}()
+		// ошибка отправки отменяет ctx, поэтому важнее той, что из-за отмены
+		fail := func(err error) error {
+			select {
+			case sent := <-sendErr:
+				if sent != nil {
+					return sent
+				}
+			default:
+			}
+			return err
+		}
+
+		from := 0
+		for {
+			var res remoteResults
+			if err := c.call(ctx, http.MethodGet, base+"/results?from="+strconv.Itoa(from), nil, &res); err != nil {
+				return fail(err)
+			}
+			for _, data := range res.Results {
+				val, err := opts.Codecs.out().Decode(data)
+				if err != nil {
+					return err
+				}
+				if err := send(ctx, out, val); err != nil {
+					return fail(err)
+				}
+			}
+			from += len(res.Results)
+			if res.Done && len(res.Results) == 0 {
+				break
+			}
+		}
+		return <-sendErr
+	}
+}
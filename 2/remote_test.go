@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// lossyHandler выполняет каждый третий запрос, но клиенту отвечает ошибкой,
+// как будто ответ потерялся по дороге
+type lossyHandler struct {
+	next  http.Handler
+	count uint32
+}
+
+func (h *lossyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if atomic.AddUint32(&h.count, 1)%3 == 1 {
+		h.next.ServeHTTP(httptest.NewRecorder(), r)
+		http.Error(w, "lost", http.StatusBadGateway)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+func TestRemoteStage(t *testing.T) {
+	upper := NewRemoteServer(func(in, out chan interface{}) {
+		for val := range in {
+			out <- strings.ToUpper(val.(string))
+		}
+	})
+	srv := httptest.NewServer(&lossyHandler{next: upper})
+	defer srv.Close()
+
+	var res []string
+	err := ExecutePipelineContext(context.Background(),
+		func(ctx context.Context, in, out chan interface{}) error {
+			for _, val := range []string{"a", "b", "c", "d", "e"} {
+				if err := send(ctx, out, val); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		RemoteStage(srv.URL, RemoteOptions{Retries: 3, Backoff: time.Millisecond}),
+		func(ctx context.Context, in, out chan interface{}) error {
+			for val := range in {
+				res = append(res, val.(string))
+			}
+			return nil
+		},
+	)
+
+	if err != nil || strings.Join(res, "") != "ABCDE" {
+		t.Errorf("unexpected result: %v (%v)", res, err)
+	}
+	upper.mu.Lock()
+	left := len(upper.sessions)
+	upper.mu.Unlock()
+	if left != 0 {
+		t.Errorf("%d sessions left on server", left)
+	}
+}
+
+func TestRemoteIdle(t *testing.T) {
+	done := make(chan struct{}, 2)
+	echo := NewRemoteServer(func(in, out chan interface{}) {
+		for val := range in {
+			time.Sleep(100 * time.Millisecond)
+			out <- val
+		}
+		done <- struct{}{}
+	})
+	echo.IdleTimeout = 50 * time.Millisecond
+	srv := httptest.NewServer(echo)
+	defer srv.Close()
+
+	// запрос дольше IdleTimeout сессию не теряет
+	var res []string
+	err := ExecutePipelineContext(context.Background(),
+		func(ctx context.Context, in, out chan interface{}) error {
+			return send(ctx, out, "a")
+		},
+		RemoteStage(srv.URL, RemoteOptions{}),
+		func(ctx context.Context, in, out chan interface{}) error {
+			for val := range in {
+				res = append(res, val.(string))
+			}
+			return nil
+		},
+	)
+	if err != nil || strings.Join(res, "") != "a" {
+		t.Fatalf("unexpected result: %v (%v)", res, err)
+	}
+	<-done
+
+	// клиент отправил значение и пропал, не забрав результат
+	c := &remoteClient{url: srv.URL}
+	ctx := context.Background()
+	if err := c.call(ctx, http.MethodPut, "/lost", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.call(ctx, http.MethodPost, "/lost/items", remoteItem{0, json.RawMessage(`"b"`)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job of an abandoned session still runs")
+	}
+
+	echo.mu.Lock()
+	left := len(echo.sessions)
+	echo.mu.Unlock()
+	var remoteErr *remoteError
+	err = c.call(ctx, http.MethodGet, "/lost/results?from=0", nil, nil)
+	if left != 0 || !errors.As(err, &remoteErr) || remoteErr.status != http.StatusNotFound {
+		t.Errorf("session not forgotten: %d left, %v", left, err)
+	}
+}
+
+func TestRemoteTyped(t *testing.T) {
+	codecs := RemoteCodecs{In: TypedCodec[uint32](), Out: TypedCodec[uint32]()}
+	triple := NewRemoteServer(func(in, out chan interface{}) {
+		for val := range in {
+			out <- val.(uint32) * 3
+		}
+	})
+	triple.Codecs = codecs
+	srv := httptest.NewServer(triple)
+	defer srv.Close()
+
+	run := func(values ...interface{}) (uint32, error) {
+		var sum uint32
+		err := ExecutePipelineContext(context.Background(),
+			func(ctx context.Context, in, out chan interface{}) error {
+				for _, val := range values {
+					if err := send(ctx, out, val); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			RemoteStage(srv.URL, RemoteOptions{Codecs: codecs}),
+			func(ctx context.Context, in, out chan interface{}) error {
+				for val := range in {
+					sum += val.(uint32)
+				}
+				return nil
+			},
+		)
+		return sum, err
+	}
+
+	if sum, err := run(uint32(1), uint32(3), uint32(4)); err != nil || sum != (1+3+4)*3 {
+		t.Errorf("unexpected result: %d (%v)", sum, err)
+	}
+	if _, err := run(uint32(1), "2"); err == nil || !strings.Contains(err.Error(), "expected uint32") {
+		t.Errorf("value of a wrong type was sent: %v", err)
+	}
+}
+
+func TestRemoteStageUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	err := ExecutePipelineContext(context.Background(),
+		RemoteStage(srv.URL, RemoteOptions{Retries: 2, Backoff: time.Millisecond}),
+	)
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRemoteSigner(t *testing.T) {
+	single := httptest.NewServer(NewRemoteServer(SingleHash))
+	defer single.Close()
+	multi := httptest.NewServer(NewRemoteServer(MultiHash))
+	defer multi.Close()
+
+	var res []string
+	err := ExecutePipelineContext(context.Background(),
+		func(ctx context.Context, in, out chan interface{}) error {
+			for _, num := range []int{0, 1} {
+				if err := send(ctx, out, num); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		RemoteStage(single.URL, RemoteOptions{}),
+		RemoteStage(multi.URL, RemoteOptions{}),
+		func(ctx context.Context, in, out chan interface{}) error {
+			for val := range in {
+				res = append(res, val.(string))
+			}
+			return nil
+		},
+	)
+
+	sort.Strings(res)
+	expected := "29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542"
+	if err != nil || strings.Join(res, "_") != expected {
+		t.Errorf("results not match\nGot: %v (%v)\nExpected: %v", res, err, expected)
+	}
+}
@@ -1,8 +1,7 @@
 package main
 
 import (
-	"fmt"
-	"sort"
+	"context"
 	"sync"
 )
 
@@ -10,109 +9,146 @@ var (
 	ths = [...]string{"0", "1", "2", "3", "4", "5"}
 )
 
+// ExecutePipeline оставлен для старых job: это ExecutePipelineContext без отмены
 func ExecutePipeline(tasks ...job) {
-
-	chans := make([]chan interface{}, len(tasks)+1)
-
-	wg := &sync.WaitGroup{}
-	wg.Add(len(tasks))
-
-	for i := range chans {
-		chans[i] = make(chan interface{})
+	ctxTasks := make([]ctxJob, len(tasks))
+	for i, task := range tasks {
+		ctxTasks[i] = withContext(task)
 	}
+	ExecutePipelineContext(context.Background(), ctxTasks...)
+}
 
-	for i := range tasks {
-		go func(itr int) {
-			defer wg.Done()
-			tasks[itr](chans[itr], chans[itr+1])
-			close(chans[itr+1])
-		}(i)
-	}
+// SignerConfig - ограничения параллельности стадий подписи
+type SignerConfig struct {
+	SingleWorkers int          // сколько значений SingleHash считает одновременно
+	MultiWorkers  int          // то же для MultiHash, у каждого ещё len(ths) вызовов crc32
+	Buffer        int          // сколько готовых значений стадия держит, не дожидаясь следующей
+	Ordered       bool         // выдавать результаты в порядке входа, а не по готовности
+	Md5Limiter    *Limiter     // квота на DataSignerMd5; nil - общая md5Limiter
+	Cache         *SignerCache // запоминать подписи; nil - считать каждый раз
+	OnError       func(error)  // перегревы DataSignerMd5 (*OverheatError); nil - только OverheatCount
+}
 
-	wg.Wait()
+// md5Limiter - одна квота на все стадии подписи: сигнатор глобальный,
+// и две параллельные подписи со своими квотами всё равно его перегреют
+var md5Limiter = NewLimiter(LimiterConfig{MaxInFlight: 1})
 
+// DefaultSignerConfig успевает посчитать MaxInputDataLen значений за один проход
+var DefaultSignerConfig = SignerConfig{
+	SingleWorkers: MaxInputDataLen,
+	MultiWorkers:  MaxInputDataLen,
 }
 
-func SingleHash(in, out chan interface{}) {
-	waits := &sync.WaitGroup{}
-	mu := &sync.Mutex{}
-	for elem := range in {
-		waits.Add(1)
-		go func(curElem interface{}) {
-			defer waits.Done()
-			str := fmt.Sprint(curElem)
-			wg := &sync.WaitGroup{}
-			wg.Add(1)
-			var temp, temp2 string
-			go func() {
-				defer wg.Done()
-				temp = DataSignerCrc32(str) + "~"
-			}()
-			mu.Lock()
-			temp2 = DataSignerMd5(str)
-			mu.Unlock()
-			temp2 = DataSignerCrc32(temp2)
-			wg.Wait()
-			out <- temp + temp2
-		}(elem)
-	}
-	waits.Wait()
+// NewSigner - полный расчёт хеш-суммы: SingleHash -> MultiHash -> CombineResults
+func NewSigner(cfg SignerConfig) Stage[string, string] {
+	return Then(NewHasher(cfg), combineResults)
 }
 
-func MultiHash(in, out chan interface{}) {
+// NewHasher - SingleHash -> MultiHash без сведения: хеш каждого значения
+// отдаётся сразу, с Ordered - в порядке входа
+func NewHasher(cfg SignerConfig) Stage[string, string] {
+	return Then(singleHashStage(cfg), multiHashStage(cfg))
+}
 
-	waits := &sync.WaitGroup{}
+// Signer - расчёт с настройками по умолчанию
+var Signer = NewSigner(DefaultSignerConfig)
 
-	for elem := range in {
-		waits.Add(1)
-		go func(curElem interface{}) {
-			defer waits.Done()
-			ans := ""
-			str := fmt.Sprint(curElem)
-			crcSlice := make([]string, 6)
+func SingleHash(in, out chan interface{}) {
+	asJob(singleHashStage(DefaultSignerConfig), toString)(in, out)
+}
 
-			wg := &sync.WaitGroup{}
-			wg.Add(6)
+func MultiHash(in, out chan interface{}) {
+	asJob(multiHashStage(DefaultSignerConfig), toString)(in, out)
+}
 
-			for i := range ths {
-				go func(num int) {
-					defer wg.Done()
-					crcSlice[num] = DataSignerCrc32(ths[num] + str)
-				}(i)
-			}
+func CombineResults(in, out chan interface{}) {
+	asJob(combineResults, toString)(in, out)
+}
 
-			wg.Wait()
+func (cfg SignerConfig) report(err error) {
+	if cfg.OnError != nil {
+		cfg.OnError(err)
+	}
+}
 
-			for _, part := range crcSlice {
-				ans += part
+// signers - сигнаторы стадии с учётом кеша. Глобальные переменные
+// читаются при каждом вызове, чтобы их можно было подменить
+func (cfg SignerConfig) signers() (crc32, md5 func(string) string) {
+	limiter := cfg.Md5Limiter
+	if limiter == nil {
+		limiter = md5Limiter
+	}
+	crc32 = func(data string) string {
+		return DataSignerCrc32(data)
+	}
+	md5 = func(data string) (res string) {
+		// без отмены квота только ждёт, поэтому Do не возвращает ошибку
+		limiter.Do(context.Background(), func() {
+			// слот квоты наш, так что перегрев за это время - чей-то вызов в обход неё
+			before := OverheatCount()
+			res = DataSignerMd5(data)
+			if OverheatCount() != before {
+				cfg.report(&OverheatError{Op: "md5"})
 			}
-
-			out <- ans
-		}(elem)
+		})
+		return res
+	}
+	if cfg.Cache != nil {
+		crc32, md5 = cfg.Cache.Crc32.Wrap(crc32), cfg.Cache.Md5.Wrap(md5)
 	}
+	return crc32, md5
+}
 
-	waits.Wait()
+// pool выбирает пул воркеров: по готовности или с сохранением порядка
+func pool(cfg SignerConfig, workers int, fn func(string) string) Stage[string, string] {
+	if cfg.Ordered {
+		return Ordered(workers, fn)
+	}
+	return Parallel(workers, fn)
+}
 
+func singleHashStage(cfg SignerConfig) Stage[string, string] {
+	crc32, md5 := cfg.signers()
+	return Buffered(pool(cfg, cfg.SingleWorkers, func(str string) string {
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		var temp, temp2 string
+		go func() {
+			defer wg.Done()
+			temp = crc32(str) + "~"
+		}()
+		temp2 = crc32(md5(str))
+		wg.Wait()
+		return temp + temp2
+	}), cfg.Buffer)
 }
 
-func CombineResults(in, out chan interface{}) {
-	strs := make([]string, 0)
-	for elem := range in {
-		strs = append(strs, fmt.Sprint(elem))
-	}
+func multiHashStage(cfg SignerConfig) Stage[string, string] {
+	crc32, _ := cfg.signers()
+	return Buffered(pool(cfg, cfg.MultiWorkers, func(str string) string {
+		ans := ""
+		crcSlice := make([]string, len(ths))
 
-	sort.Slice(strs, func(i, j int) bool {
-		return strs[i] < strs[j]
-	})
+		wg := &sync.WaitGroup{}
+		wg.Add(len(ths))
 
-	ans := ""
-	for i, elem := range strs {
-		ans += elem
-		if i != len(strs)-1 {
-			ans += "_"
+		for i := range ths {
+			go func(num int) {
+				defer wg.Done()
+				crcSlice[num] = crc32(ths[num] + str)
+			}(i)
 		}
-	}
 
-	out <- ans
+		wg.Wait()
+
+		for _, part := range crcSlice {
+			ans += part
+		}
+		return ans
+	}), cfg.Buffer)
+}
 
+// combineResults - одно окно на весь поток
+func combineResults(in <-chan string, out chan<- string) {
+	Window(WindowConfig{}, JoinSorted("_"))(in, out)
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Stage - типизированное звено конвейера: читает In, пишет Out.
+// Выходной канал закрывает тот, кто запустил стадию, а не она сама
+type Stage[In, Out any] func(in <-chan In, out chan<- Out)
+
+// Stream запускает стадию в отдельной горутине и отдаёт её выход
+func Stream[In, Out any](s Stage[In, Out], in <-chan In) <-chan Out {
+	out := make(chan Out)
+	go func() {
+		s(in, out)
+		close(out)
+		drain(in)
+	}()
+	return out
+}
+
+// Then соединяет две стадии; неподходящие типы не скомпилируются
+func Then[A, B, C any](first Stage[A, B], second Stage[B, C]) Stage[A, C] {
+	return func(in <-chan A, out chan<- C) {
+		for val := range Stream(second, Stream(first, in)) {
+			out <- val
+		}
+	}
+}
+
+// Run прогоняет значения через стадию и собирает весь результат
+func Run[In, Out any](s Stage[In, Out], values ...In) []Out {
+	in := make(chan In)
+	go func() {
+		for _, val := range values {
+			in <- val
+		}
+		close(in)
+	}()
+
+	var res []Out
+	for val := range Stream(s, in) {
+		res = append(res, val)
+	}
+	return res
+}
+
+// asJob превращает типизированную стадию в job для ExecutePipeline,
+// conv приводит нетипизированный вход к In
+func asJob[In, Out any](s Stage[In, Out], conv func(interface{}) In) job {
+	return func(in, out chan interface{}) {
+		typed := make(chan In)
+		go func() {
+			for val := range in {
+				typed <- conv(val)
+			}
+			close(typed)
+		}()
+
+		for val := range Stream(s, typed) {
+			out <- val
+		}
+	}
+}
+
+func toString(val interface{}) string {
+	return fmt.Sprint(val)
+}
+
+// Parallel обрабатывает вход не более чем workers горутинами.
+// Пока все заняты, новые значения не читаются - источник ждёт
+func Parallel[In, Out any](workers int, fn func(In) Out) Stage[In, Out] {
+	if workers < 1 {
+		workers = 1
+	}
+	return func(in <-chan In, out chan<- Out) {
+		wg := &sync.WaitGroup{}
+		wg.Add(workers)
+		for i := 0; i < workers; i++ {
+			go func() {
+				defer wg.Done()
+				for val := range in {
+					out <- fn(val)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// Buffered даёт стадии очередь на size готовых значений, чтобы она
+// не простаивала, пока следующая занята
+func Buffered[In, Out any](s Stage[In, Out], size int) Stage[In, Out] {
+	if size <= 0 {
+		return s
+	}
+	return func(in <-chan In, out chan<- Out) {
+		queue := make(chan Out, size)
+		go func() {
+			s(in, queue)
+			close(queue)
+		}()
+		for val := range queue {
+			out <- val
+		}
+	}
+}
+
+// seqItem - значение с номером во входном потоке
+type seqItem[T any] struct {
+	seq int
+	val T
+}
+
+// Ordered как Parallel, но отдаёт результаты в порядке входа.
+// Обогнавшие результаты ждут в буфере; в работе и в буфере вместе
+// не больше workers значений, так что буфер не растёт без предела
+func Ordered[In, Out any](workers int, fn func(In) Out) Stage[In, Out] {
+	if workers < 1 {
+		workers = 1
+	}
+	return func(in <-chan In, out chan<- Out) {
+		window := make(chan struct{}, workers)
+		tagged := make(chan seqItem[In])
+		go func() {
+			seq := 0
+			for val := range in {
+				window <- struct{}{}
+				tagged <- seqItem[In]{seq, val}
+				seq++
+			}
+			close(tagged)
+		}()
+
+		work := Parallel(workers, func(item seqItem[In]) seqItem[Out] {
+			return seqItem[Out]{item.seq, fn(item.val)}
+		})
+
+		pending := map[int]Out{}
+		next := 0
+		for item := range Stream(work, tagged) {
+			pending[item.seq] = item.val
+			for {
+				val, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				out <- val
+				<-window
+				next++
+			}
+		}
+	}
+}
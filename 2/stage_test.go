@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStageThen(t *testing.T) {
+	double := Stage[int, int](func(in <-chan int, out chan<- int) {
+		for val := range in {
+			out <- val * 2
+		}
+	})
+	format := Stage[int, string](func(in <-chan int, out chan<- string) {
+		for val := range in {
+			out <- strconv.Itoa(val)
+		}
+	})
+	// берёт только первое значение, остальное вход должен дочитать сам
+	first := Stage[string, string](func(in <-chan string, out chan<- string) {
+		out <- <-in
+	})
+
+	res := Run(Then(Then(double, format), first), 1, 2, 3)
+	if len(res) != 1 || res[0] != "2" {
+		t.Errorf("unexpected result: %v", res)
+	}
+}
+
+func TestStageSigner(t *testing.T) {
+	res := Run(Signer, "0", "1")
+
+	expected := "29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542"
+	if len(res) != 1 || res[0] != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res, expected)
+	}
+}
+
+func TestStageParallelLimit(t *testing.T) {
+	const workers = 3
+	var cur, peak int32
+
+	square := Parallel(workers, func(val int) int {
+		n := atomic.AddInt32(&cur, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&cur, -1)
+		return val * val
+	})
+
+	values := make([]int, 20)
+	for i := range values {
+		values[i] = i
+	}
+	res := Run(Buffered(square, 4), values...)
+
+	if len(res) != len(values) {
+		t.Errorf("got %d results, expected %d", len(res), len(values))
+	}
+	if peak > workers {
+		t.Errorf("%d values processed at once, limit is %d", peak, workers)
+	}
+}
+
+func TestStageOrdered(t *testing.T) {
+	// первые значения считаются дольше всех и без сортировки пришли бы последними
+	slow := Ordered(4, func(val int) int {
+		time.Sleep(time.Duration(10-val) * time.Millisecond)
+		return val
+	})
+
+	values := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	res := Run(slow, values...)
+	for i := range values {
+		if i >= len(res) || res[i] != values[i] {
+			t.Fatalf("order not preserved: %v", res)
+		}
+	}
+}
+
+func TestStageHasherOrdered(t *testing.T) {
+	cfg := DefaultSignerConfig
+	cfg.Ordered = true
+	res := Run(NewHasher(cfg), "1", "0")
+
+	expected := []string{
+		"4958044192186797981418233587017209679042592862002427381542",
+		"29568666068035183841425683795340791879727309630931025356555",
+	}
+	if len(res) != len(expected) || res[0] != expected[0] || res[1] != expected[1] {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", res, expected)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// CombineFunc сводит значения одного окна в одно
+type CombineFunc func(items []string) string
+
+// JoinSorted - сведение как в CombineResults: сортировка и склейка через sep
+func JoinSorted(sep string) CombineFunc {
+	return func(items []string) string {
+		sorted := append([]string(nil), items...)
+		sort.Strings(sorted)
+		return strings.Join(sorted, sep)
+	}
+}
+
+// Join склеивает значения в порядке прихода
+func Join(sep string) CombineFunc {
+	return func(items []string) string {
+		return strings.Join(items, sep)
+	}
+}
+
+// WindowConfig - как резать поток на окна. Задаётся либо Size, либо Duration;
+// без обоих окно одно - весь поток. Шаг 0 - окна не пересекаются
+type WindowConfig struct {
+	Size     int           // значений в окне
+	Slide    int           // через сколько значений выдавать следующее окно
+	Duration time.Duration // длина окна по времени
+	Step     time.Duration // как часто выдавать окно по времени
+}
+
+// Window сводит поток по окнам. В конце входа выдаётся последнее окно,
+// если в нём есть значения, ещё не попавшие ни в одно окно
+func Window(cfg WindowConfig, combine CombineFunc) Stage[string, string] {
+	switch {
+	case cfg.Duration > 0:
+		return timeWindow(cfg, combine)
+	case cfg.Size > 0:
+		return countWindow(cfg, combine)
+	}
+	return func(in <-chan string, out chan<- string) {
+		var items []string
+		for elem := range in {
+			items = append(items, elem)
+		}
+		out <- combine(items)
+	}
+}
+
+// CombineWindows - Window для ExecutePipeline
+func CombineWindows(cfg WindowConfig, combine CombineFunc) job {
+	return asJob(Window(cfg, combine), toString)
+}
+
+func countWindow(cfg WindowConfig, combine CombineFunc) Stage[string, string] {
+	slide := cfg.Slide
+	if slide <= 0 || slide > cfg.Size {
+		slide = cfg.Size
+	}
+	return func(in <-chan string, out chan<- string) {
+		var items []string
+		fresh := 0 // сколько значений ещё не выдано ни в одном окне
+		for elem := range in {
+			items = append(items, elem)
+			if len(items) > cfg.Size {
+				items = items[len(items)-cfg.Size:]
+			}
+			fresh++
+			if len(items) == cfg.Size && fresh >= slide {
+				out <- combine(items)
+				fresh = 0
+				if slide == cfg.Size {
+					items = nil
+				}
+			}
+		}
+		if fresh > 0 {
+			out <- combine(items)
+		}
+	}
+}
+
+type timedItem struct {
+	at  time.Time
+	val string
+}
+
+func timeWindow(cfg WindowConfig, combine CombineFunc) Stage[string, string] {
+	step := cfg.Step
+	if step <= 0 {
+		step = cfg.Duration
+	}
+	sliding := step < cfg.Duration
+	return func(in <-chan string, out chan<- string) {
+		ticker := time.NewTicker(step)
+		defer ticker.Stop()
+
+		var items []timedItem
+		fresh := false
+		emit := func(now time.Time) {
+			// в скользящем окне выбрасываем то, что вышло за его длину,
+			// непересекающееся окно очищается целиком после выдачи
+			idx := 0
+			for sliding && idx < len(items) && now.Sub(items[idx].at) > cfg.Duration {
+				idx++
+			}
+			items = items[idx:]
+			if !fresh || len(items) == 0 {
+				return
+			}
+			vals := make([]string, len(items))
+			for i, item := range items {
+				vals[i] = item.val
+			}
+			out <- combine(vals)
+			fresh = false
+		}
+
+		for {
+			select {
+			case elem, ok := <-in:
+				if !ok {
+					emit(time.Now())
+					return
+				}
+				items = append(items, timedItem{time.Now(), elem})
+				fresh = true
+			case now := <-ticker.C:
+				emit(now)
+				if !sliding {
+					items = items[:0]
+				}
+			}
+		}
+	}
+}
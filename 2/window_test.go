@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWindowCount(t *testing.T) {
+	values := []string{"a", "b", "c", "d", "e"}
+	cases := []struct {
+		cfg      WindowConfig
+		expected []string
+	}{
+		{WindowConfig{}, []string{"a,b,c,d,e"}},
+		{WindowConfig{Size: 2}, []string{"a,b", "c,d", "e"}},
+		{WindowConfig{Size: 3, Slide: 1}, []string{"a,b,c", "b,c,d", "c,d,e"}},
+		{WindowConfig{Size: 2, Slide: 2}, []string{"a,b", "c,d", "e"}},
+		{WindowConfig{Size: 4, Slide: 3}, []string{"a,b,c,d", "b,c,d,e"}},
+	}
+
+	for _, c := range cases {
+		res := Run(Window(c.cfg, Join(",")), values...)
+		if !reflect.DeepEqual(res, c.expected) {
+			t.Errorf("%+v: got %v, expected %v", c.cfg, res, c.expected)
+		}
+	}
+}
+
+func TestWindowTime(t *testing.T) {
+	// по два значения с паузой больше окна - каждая пара попадает в своё окно
+	feed := func(in chan<- string) {
+		for _, pair := range [][]string{{"b", "a"}, {"d", "c"}} {
+			for _, val := range pair {
+				in <- val
+			}
+			time.Sleep(70 * time.Millisecond)
+		}
+		close(in)
+	}
+
+	in := make(chan string)
+	go feed(in)
+	var res []string
+	for val := range Stream(Window(WindowConfig{Duration: 50 * time.Millisecond}, JoinSorted("_")), in) {
+		res = append(res, val)
+	}
+	if !reflect.DeepEqual(res, []string{"a_b", "c_d"}) {
+		t.Errorf("tumbling: got %v", res)
+	}
+
+	// скользящее окно помнит значения Duration, но выдаёт их каждые Step
+	in = make(chan string)
+	go feed(in)
+	res = nil
+	sliding := WindowConfig{Duration: time.Second, Step: 50 * time.Millisecond}
+	for val := range Stream(Window(sliding, JoinSorted("_")), in) {
+		res = append(res, val)
+	}
+	if !reflect.DeepEqual(res, []string{"a_b", "a_b_c_d"}) {
+		t.Errorf("sliding: got %v", res)
+	}
+}
@@ -1,118 +1,54 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
-	"regexp"
-	"strings"
+	"runtime"
 )
 
-// вам надо написать более быструю оптимальную этой функции
-func FastSearch(out io.Writer) {
-	/*
-		!!! !!! !!!
-		обратите внимание - в задании обязательно нужен отчет
-		делать его лучше в самом начале, когда вы видите уже узкие места, но еще не оптимизировалм их
-		так же обратите внимание на команду с параметром -http
-		перечитайте еще раз задание
-		!!! !!! !!!
-	*/
-	file, err := os.Open(filePath)
-	if err != nil {
-		panic(err)
-	}
+// maxLineLen - самая длинная строка users.txt, которую мы готовы прочитать
+const maxLineLen = 1024 * 1024
 
-	fileContents, err := ioutil.ReadAll(file)
-	if err != nil {
-		panic(err)
-	}
+// User - поля записи, которые нужны для поиска, остальное пропускается
+type User struct {
+	Browsers []string `json:"browsers"`
+	Email    string   `json:"email"`
+	Name     string   `json:"name"`
+}
 
-	r := regexp.MustCompile("@")
-	seenBrowsers := []string{}
-	uniqueBrowsers := 0
-	foundUsers := ""
+// FastSearch - отчёт SlowSearch как запрос AndroidMSIE. Если есть свежий
+// индекс (go run . -index), читаются только нужные строки, иначе файл делится
+// на куски по числу ядер, каждый читается построчно в своей горутине
+func FastSearch(out io.Writer) {
+	searchFile(out, filePath, indexPath, runtime.NumCPU())
+}
 
-	lines := strings.Split(string(fileContents), "\n")
+func fastSearch(out io.Writer, workers int) {
+	searchFile(out, filePath, "", workers)
+}
 
-	users := make([]map[string]interface{}, 0)
-	for _, line := range lines {
-		user := make(map[string]interface{})
-		// fmt.Printf("%v %v\n", err, line)
-		err := json.Unmarshal([]byte(line), &user)
-		if err != nil {
-			panic(err)
-		}
-		users = append(users, user)
+// searchFile - поиск по dataPath; пустой indexPath - без индекса
+func searchFile(out io.Writer, dataPath, indexPath string, workers int) {
+	file, err := os.Open(dataPath)
+	if err != nil {
+		panic(err)
 	}
+	defer file.Close()
 
-	for i, user := range users {
-
-		isAndroid := false
-		isMSIE := false
-
-		browsers, ok := user["browsers"].([]interface{})
-		if !ok {
-			// log.Println("cant cast browsers")
-			continue
-		}
-
-		for _, browserRaw := range browsers {
-			browser, ok := browserRaw.(string)
-			if !ok {
-				// log.Println("cant cast browser to string")
-				continue
-			}
-			if ok := strings.Contains(browser, "Android"); ok {
-				isAndroid = true
-				notSeenBefore := true
-				for _, item := range seenBrowsers {
-					if item == browser {
-						notSeenBefore = false
-					}
-				}
-				if notSeenBefore {
-					// log.Printf("SLOW New browser: %s, first seen: %s", browser, user["name"])
-					seenBrowsers = append(seenBrowsers, browser)
-					uniqueBrowsers++
-				}
-			}
-		}
-
-		for _, browserRaw := range browsers {
-			browser, ok := browserRaw.(string)
-			if !ok {
-				// log.Println("cant cast browser to string")
-				continue
-			}
-
-			if ok = strings.Contains(browser, "MSIE"); ok {
-				isMSIE = true
-				notSeenBefore := true
-				for _, item := range seenBrowsers {
-					if item == browser {
-						notSeenBefore = false
-					}
-				}
-				if notSeenBefore {
-					// log.Printf("SLOW New browser: %s, first seen: %s", browser, user["name"])
-					seenBrowsers = append(seenBrowsers, browser)
-					uniqueBrowsers++
-				}
+	if indexPath != "" {
+		if idx, err := LoadIndex(dataPath, indexPath); err == nil {
+			if err := AndroidMSIE().RunIndexed(file, idx, out); err != nil {
+				panic(err)
 			}
+			return
 		}
-
-		if !(isAndroid && isMSIE) {
-			continue
-		}
-
-		// log.Println("Android and MSIE user:", user["name"], user["email"])
-		email := r.ReplaceAllString(user["email"].(string), " [at] ")
-		foundUsers += fmt.Sprintf("[%d] %s <%s>\n", i, user["name"], email)
 	}
 
-	fmt.Fprintln(out, "found users:\n"+foundUsers)
-	fmt.Fprintln(out, "Total unique browsers", len(seenBrowsers))
+	info, err := file.Stat()
+	if err != nil {
+		panic(err)
+	}
+	if err := AndroidMSIE().RunParallel(file, info.Size(), workers, out); err != nil {
+		panic(err)
+	}
 }
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	indexPath    = filePath + ".idx"
+	indexVersion = 1
+)
+
+var errStaleIndex = errors.New("index does not match the data file")
+
+// Index - обратный индекс users.txt: слово из браузера -> номера строк.
+// Size и ModTime файла на момент построения - если файл изменился, индекс не годится
+type Index struct {
+	Version int
+	Size    int64
+	ModTime int64
+	Offsets []int64            // где начинается каждая строка
+	Tokens  map[string][]int32 // номера строк по возрастанию
+}
+
+func isWordByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// tokens вызывает fn на каждое слово - максимальный кусок из букв и цифр
+func tokens(s string, fn func(string)) {
+	start := -1
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) && isWordByte(s[i]) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			fn(s[start:i])
+			start = -1
+		}
+	}
+}
+
+// BuildIndex читает файл целиком один раз и собирает индекс по браузерам
+func BuildIndex(path string) (*Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &Index{
+		Version: indexVersion,
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Tokens:  map[string][]int32{},
+	}
+	line := int32(0)
+	addToken := func(token string) {
+		lines := idx.Tokens[token]
+		if len(lines) == 0 || lines[len(lines)-1] != line {
+			idx.Tokens[token] = append(lines, line)
+		}
+	}
+
+	in := &offsetReader{r: file}
+	_, err = scanUsers(in, func(i int, u *User) {
+		line = int32(i)
+		for _, browser := range u.Browsers {
+			tokens(browser, addToken)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	idx.Offsets = in.offsets
+	return idx, nil
+}
+
+// offsetReader запоминает, где начинается каждая строка, пока её читает сканер
+type offsetReader struct {
+	r       io.Reader
+	offset  int64
+	offsets []int64
+	inLine  bool
+}
+
+func (o *offsetReader) Read(p []byte) (int, error) {
+	n, err := o.r.Read(p)
+	for _, c := range p[:n] {
+		if !o.inLine {
+			o.offsets = append(o.offsets, o.offset)
+			o.inLine = true
+		}
+		if c == '\n' {
+			o.inLine = false
+		}
+		o.offset++
+	}
+	return n, err
+}
+
+// Save пишет индекс через временный файл, чтобы читатель не увидел половину
+func (idx *Index) Save(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".idx-*")
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(tmp).Encode(idx)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// LoadIndex читает индекс и проверяет, что он построен по текущему dataPath
+func LoadIndex(dataPath, path string) (*Index, error) {
+	info, err := os.Stat(dataPath)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	idx := &Index{}
+	if err := gob.NewDecoder(file).Decode(idx); err != nil {
+		return nil, err
+	}
+	if idx.Version != indexVersion || idx.Size != info.Size() || idx.ModTime != info.ModTime().UnixNano() {
+		return nil, errStaleIndex
+	}
+	return idx, nil
+}
+
+// candidates - строки, где есть браузер с одной из подстрок subs.
+// Подстрока из букв и цифр целиком лежит внутри одного слова, поэтому
+// хватает словаря; с другими символами индекс не поможет - false
+func (idx *Index) candidates(subs []string) ([]int32, bool) {
+	if len(subs) == 0 {
+		return nil, false
+	}
+	seen := map[int32]bool{}
+	var res []int32
+	for _, sub := range subs {
+		for i := 0; i < len(sub); i++ {
+			if !isWordByte(sub[i]) {
+				return nil, false
+			}
+		}
+		for token, lines := range idx.Tokens {
+			if !strings.Contains(token, sub) {
+				continue
+			}
+			for _, line := range lines {
+				if !seen[line] {
+					seen[line] = true
+					res = append(res, line)
+				}
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res, true
+}
+
+// RunIndexed - Run только по строкам, где есть браузер с одной из q.IndexHints:
+// остальные строки на отчёт не влияют
+func (q Query) RunIndexed(r io.ReaderAt, idx *Index, out io.Writer) error {
+	lines, ok := idx.candidates(q.IndexHints)
+	if !ok {
+		return errors.New("query cannot use the index")
+	}
+
+	w := bufio.NewWriter(out)
+	fmt.Fprintln(w, "found users:")
+	var buf []byte
+	user := User{}
+	for _, line := range lines {
+		start := idx.Offsets[line]
+		end := idx.Size
+		if int(line)+1 < len(idx.Offsets) {
+			end = idx.Offsets[line+1]
+		}
+		if need := int(end - start); cap(buf) < need {
+			buf = make([]byte, need)
+		}
+		buf = buf[:end-start]
+		if _, err := r.ReadAt(buf, start); err != nil && err != io.EOF {
+			return err
+		}
+
+		user = User{Browsers: user.Browsers[:0]}
+		if err := user.UnmarshalJSON(bytes.TrimRight(buf, "\r\n")); err != nil {
+			return fmt.Errorf("line %d: %w", line+1, err)
+		}
+		for _, agg := range q.Aggregates {
+			agg.add(&user)
+		}
+		if q.Where == nil || q.Where(&user) {
+			formatUser(w, int(line), user.Name, user.Email)
+		}
+	}
+
+	q.report(w)
+	return w.Flush()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIndex(t *testing.T) {
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "users.txt")
+	idxPath := dataPath + ".idx"
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dataPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := BuildIndex(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Save(idxPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := idx.candidates([]string{"Windows NT"}); ok {
+		t.Errorf("index used for a hint with a space")
+	}
+
+	slowOut := new(bytes.Buffer)
+	SlowSearch(slowOut)
+
+	if _, err := LoadIndex(dataPath, idxPath); err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	searchFile(out, dataPath, idxPath, 1)
+	if out.String() != slowOut.String() {
+		t.Errorf("indexed: results not match\nGot:\n%v\nExpected:\n%v", out, slowOut)
+	}
+
+	// файл изменился - индекс устарел, поиск идёт по файлу и видит нового пользователя
+	data = append(data, []byte("\n"+`{"browsers":["Android 4 MSIE 9"],"email":"new@user","name":"New"}`)...)
+	if err := ioutil.WriteFile(dataPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadIndex(dataPath, idxPath); !errors.Is(err, errStaleIndex) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	out.Reset()
+	searchFile(out, dataPath, idxPath, 1)
+	if !bytes.Contains(out.Bytes(), []byte("[1000] New <new [at] user>\n")) {
+		t.Errorf("stale index used:\n%v", out)
+	}
+
+	// тот же размер, но другое время изменения
+	later := time.Now().Add(time.Hour)
+	idx, _ = BuildIndex(dataPath)
+	idx.Save(idxPath)
+	os.Chtimes(dataPath, later, later)
+	if _, err := LoadIndex(dataPath, idxPath); !errors.Is(err, errStaleIndex) {
+		t.Errorf("unexpected error after touch: %v", err)
+	}
+}
+
+func BenchmarkFastIndexed(b *testing.B) {
+	dir := b.TempDir()
+	idxPath := filepath.Join(dir, "users.txt.idx")
+	idx, err := BuildIndex(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := idx.Save(idxPath); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		searchFile(ioutil.Discard, filePath, idxPath, 1)
+	}
+}
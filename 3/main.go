@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	buildIndex := flag.Bool("index", false, "build the index "+indexPath+" and exit")
+	flag.Parse()
+
+	if !*buildIndex {
+		FastSearch(os.Stdout)
+		return
+	}
+
+	idx, err := BuildIndex(filePath)
+	if err == nil {
+		err = idx.Save(indexPath)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("indexed %d users, %d tokens\n", len(idx.Offsets), len(idx.Tokens))
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Str - условие на строку
+type Str func(s string) bool
+
+func Contains(sub string) Str {
+	return func(s string) bool {
+		return strings.Contains(s, sub)
+	}
+}
+
+// Regexp - условие по регулярному выражению, неверное выражение - паника
+func Regexp(expr string) Str {
+	re := regexp.MustCompile(expr)
+	return re.MatchString
+}
+
+func AnyOf(conds ...Str) Str {
+	return func(s string) bool {
+		for _, cond := range conds {
+			if cond(s) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func AllOf(conds ...Str) Str {
+	return func(s string) bool {
+		for _, cond := range conds {
+			if !cond(s) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Pred - условие на пользователя
+type Pred func(u *User) bool
+
+// AnyBrowser - хотя бы один браузер подходит под cond
+func AnyBrowser(cond Str) Pred {
+	return func(u *User) bool {
+		for _, browser := range u.Browsers {
+			if cond(browser) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AllBrowsers - все браузеры подходят под cond, у пользователя без браузеров - нет
+func AllBrowsers(cond Str) Pred {
+	return func(u *User) bool {
+		for _, browser := range u.Browsers {
+			if !cond(browser) {
+				return false
+			}
+		}
+		return len(u.Browsers) > 0
+	}
+}
+
+func Name(cond Str) Pred {
+	return func(u *User) bool {
+		return cond(u.Name)
+	}
+}
+
+func Email(cond Str) Pred {
+	return func(u *User) bool {
+		return cond(u.Email)
+	}
+}
+
+func And(preds ...Pred) Pred {
+	return func(u *User) bool {
+		for _, pred := range preds {
+			if !pred(u) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func Or(preds ...Pred) Pred {
+	return func(u *User) bool {
+		for _, pred := range preds {
+			if pred(u) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func Not(pred Pred) Pred {
+	return func(u *User) bool {
+		return !pred(u)
+	}
+}
+
+// Values - что агрегировать у пользователя: emit вызывается на каждое значение
+type Values func(u *User, emit func(string))
+
+// Browsers - браузеры пользователя, подходящие под cond
+func Browsers(cond Str) Values {
+	return func(u *User, emit func(string)) {
+		for _, browser := range u.Browsers {
+			if cond(browser) {
+				emit(browser)
+			}
+		}
+	}
+}
+
+// EmailDomain - часть почты после @
+func EmailDomain() Values {
+	return func(u *User, emit func(string)) {
+		if idx := strings.LastIndexByte(u.Email, '@'); idx >= 0 {
+			emit(u.Email[idx+1:])
+		}
+	}
+}
+
+// Only ограничивает значения пользователями, подходящими под pred
+func Only(pred Pred, vals Values) Values {
+	return func(u *User, emit func(string)) {
+		if pred(u) {
+			vals(u, emit)
+		}
+	}
+}
+
+// Aggregate копит значения по всем пользователям и печатает итог в конце
+type Aggregate interface {
+	add(u *User)
+	report(w io.Writer)
+	// fresh - пустой агрегат с теми же настройками, для отдельного куска файла
+	fresh() Aggregate
+	// merge добавляет накопленное в другом агрегате того же вида
+	merge(other Aggregate)
+}
+
+// counter - сколько раз встретилось каждое значение
+type counter struct {
+	title  string
+	vals   Values
+	counts map[string]int
+	emit   func(string)
+}
+
+func newCounter(title string, vals Values) counter {
+	return counter{title: title, vals: vals, counts: map[string]int{}}
+}
+
+func (c *counter) add(u *User) {
+	if c.emit == nil {
+		c.emit = func(val string) {
+			c.counts[val]++
+		}
+	}
+	c.vals(u, c.emit)
+}
+
+func (c *counter) mergeCounts(other *counter) {
+	for val, count := range other.counts {
+		c.counts[val] += count
+	}
+}
+
+// sorted - значения по убыванию числа, при равенстве по алфавиту
+func (c *counter) sorted() []string {
+	keys := make([]string, 0, len(c.counts))
+	for key := range c.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if c.counts[keys[i]] != c.counts[keys[j]] {
+			return c.counts[keys[i]] > c.counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+type distinctCount struct {
+	counter
+}
+
+// DistinctCount печатает "title N", N - число разных значений
+func DistinctCount(title string, vals Values) Aggregate {
+	return &distinctCount{newCounter(title, vals)}
+}
+
+func (d *distinctCount) fresh() Aggregate {
+	return DistinctCount(d.title, d.vals)
+}
+
+func (d *distinctCount) merge(other Aggregate) {
+	d.mergeCounts(&other.(*distinctCount).counter)
+}
+
+func (d *distinctCount) report(w io.Writer) {
+	fmt.Fprintln(w, d.title, len(d.counts))
+}
+
+type topN struct {
+	counter
+	n int
+}
+
+// TopN печатает n самых частых значений с числом повторов
+func TopN(title string, n int, vals Values) Aggregate {
+	return &topN{newCounter(title, vals), n}
+}
+
+func (t *topN) fresh() Aggregate {
+	return TopN(t.title, t.n, t.vals)
+}
+
+func (t *topN) merge(other Aggregate) {
+	t.mergeCounts(&other.(*topN).counter)
+}
+
+func (t *topN) report(w io.Writer) {
+	fmt.Fprintln(w, t.title+":")
+	keys := t.sorted()
+	if len(keys) > t.n {
+		keys = keys[:t.n]
+	}
+	for _, key := range keys {
+		fmt.Fprintf(w, "%d %s\n", t.counts[key], key)
+	}
+}
+
+type histogram struct {
+	counter
+	width int
+}
+
+// Histogram печатает все значения по алфавиту с полоской длиной до width
+func Histogram(title string, width int, vals Values) Aggregate {
+	return &histogram{newCounter(title, vals), width}
+}
+
+func (h *histogram) fresh() Aggregate {
+	return Histogram(h.title, h.width, h.vals)
+}
+
+func (h *histogram) merge(other Aggregate) {
+	h.mergeCounts(&other.(*histogram).counter)
+}
+
+func (h *histogram) report(w io.Writer) {
+	fmt.Fprintln(w, h.title+":")
+	keys := make([]string, 0, len(h.counts))
+	most := 0
+	for key, count := range h.counts {
+		keys = append(keys, key)
+		if count > most {
+			most = count
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		bar := strings.Repeat("#", (h.counts[key]*h.width+most-1)/most)
+		fmt.Fprintf(w, "%s %s %d\n", key, bar, h.counts[key])
+	}
+}
+
+// Query - кого вывести в списке найденных (nil - всех) и что посчитать по всем
+// пользователям. Агрегаты копят состояние, поэтому один Query - один запуск
+type Query struct {
+	Where      Pred
+	Aggregates []Aggregate
+	// IndexHints - подстроки браузеров: пользователь без них не попадает
+	// в список и не меняет агрегаты, так что можно читать только их по индексу
+	IndexHints []string
+}
+
+// AndroidMSIE - отчёт SlowSearch: пользователи с Android и MSIE одновременно
+// и число разных браузеров Android и MSIE у всех пользователей
+func AndroidMSIE() Query {
+	return Query{
+		Where: And(AnyBrowser(Contains("Android")), AnyBrowser(Contains("MSIE"))),
+		Aggregates: []Aggregate{
+			DistinctCount("Total unique browsers", Browsers(AnyOf(Contains("Android"), Contains("MSIE")))),
+		},
+		IndexHints: []string{"Android", "MSIE"},
+	}
+}
+
+// scanUsers разбирает строки in по очереди в один и тот же User
+func scanUsers(in io.Reader, fn func(i int, u *User)) (int, error) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxLineLen)
+
+	user := User{}
+	i := 0
+	for ; scanner.Scan(); i++ {
+		// поля, которых нет в строке, не должны остаться от прошлого пользователя
+		user = User{Browsers: user.Browsers[:0]}
+		if err := user.UnmarshalJSON(scanner.Bytes()); err != nil {
+			return i, err
+		}
+		fn(i, &user)
+	}
+	return i, scanner.Err()
+}
+
+func formatUser(w io.Writer, i int, name, email string) {
+	email = strings.Replace(email, "@", " [at] ", -1)
+	fmt.Fprintf(w, "[%d] %s <%s>\n", i, name, email)
+}
+
+func (q Query) report(w io.Writer) {
+	fmt.Fprintln(w)
+	for _, agg := range q.Aggregates {
+		agg.report(w)
+	}
+}
+
+// Run читает пользователей построчно из in и пишет отчёт в out
+func (q Query) Run(in io.Reader, out io.Writer) error {
+	w := bufio.NewWriter(out)
+	fmt.Fprintln(w, "found users:")
+
+	line, err := scanUsers(in, func(i int, u *User) {
+		for _, agg := range q.Aggregates {
+			agg.add(u)
+		}
+		if q.Where == nil || q.Where(u) {
+			formatUser(w, i, u.Name, u.Email)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("line %d: %w", line+1, err)
+	}
+
+	q.report(w)
+	return w.Flush()
+}
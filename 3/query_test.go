@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const queryUsers = `{"name":"Ann","email":"ann@a.com","browsers":["Firefox 10","Chrome 41"]}
+{"name":"Bob","email":"bob@b.org","browsers":["Chrome 41","Opera 12"]}
+{"name":"Eve","email":"eve@a.com","browsers":["Firefox 3"]}
+{"name":"Dan","email":"dan@a.com","browsers":[]}`
+
+func TestQuery(t *testing.T) {
+	q := Query{
+		Where: And(
+			AnyBrowser(Regexp(`^Chrome \d+$`)),
+			Not(Name(Contains("Bob"))),
+		),
+		Aggregates: []Aggregate{
+			DistinctCount("Browsers", Browsers(AnyOf(Contains("Firefox"), Contains("Chrome")))),
+			TopN("Top", 2, Browsers(AllOf())),
+			Histogram("Domains", 4, EmailDomain()),
+			DistinctCount("Found browsers", Only(AllBrowsers(Contains("Firefox")), Browsers(AllOf()))),
+		},
+	}
+
+	out := new(bytes.Buffer)
+	if err := q.Run(strings.NewReader(queryUsers), out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `found users:
+[0] Ann <ann [at] a.com>
+
+Browsers 3
+Top:
+2 Chrome 41
+1 Firefox 10
+Domains:
+a.com #### 3
+b.org ## 1
+Found browsers 1
+`
+	if out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), expected)
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	err := Query{}.Run(strings.NewReader("{}\n{"), new(bytes.Buffer))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+type foundUser struct {
+	line  int
+	name  string
+	email string
+}
+
+// shardBuffer - сколько найденных пользователей кусок держит, пока вывод
+// не дошёл до него; дальше кусок ждёт, так что память не растёт с файлом
+const shardBuffer = 1024
+
+// shardResult - то, что нашёл один кусок файла; номера строк в нём локальные.
+// lines, aggregates и err готовы, когда found закрыт
+type shardResult struct {
+	lines      int
+	found      chan foundUser
+	aggregates []Aggregate
+	err        error
+}
+
+// lineStart - начало первой строки, которая начинается не раньше pos
+func lineStart(r io.ReaderAt, size, pos int64) (int64, error) {
+	if pos <= 0 {
+		return 0, nil
+	}
+	buf := make([]byte, 4096)
+	// pos-1 тоже читаем: если там перевод строки, строка начинается ровно с pos
+	for off := pos - 1; off < size; off += int64(len(buf)) {
+		n, err := r.ReadAt(buf, off)
+		if idx := bytes.IndexByte(buf[:n], '\n'); idx >= 0 {
+			return off + int64(idx) + 1, nil
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
+
+// shardBounds режет [0, size) на части по границам строк; части могут совпасть
+func shardBounds(r io.ReaderAt, size int64, shards int) ([]int64, error) {
+	bounds := []int64{0}
+	for i := 1; i < shards; i++ {
+		start, err := lineStart(r, size, size*int64(i)/int64(shards))
+		if err != nil {
+			return nil, err
+		}
+		if start > bounds[len(bounds)-1] {
+			bounds = append(bounds, start)
+		}
+	}
+	if size > bounds[len(bounds)-1] {
+		bounds = append(bounds, size)
+	}
+	return bounds, nil
+}
+
+func (q Query) newShard() *shardResult {
+	res := &shardResult{
+		found:      make(chan foundUser, shardBuffer),
+		aggregates: make([]Aggregate, len(q.Aggregates)),
+	}
+	for i, agg := range q.Aggregates {
+		res.aggregates[i] = agg.fresh()
+	}
+	return res
+}
+
+func (q Query) runShard(section io.Reader, res *shardResult) {
+	defer close(res.found)
+	res.lines, res.err = scanUsers(section, func(i int, u *User) {
+		for _, agg := range res.aggregates {
+			agg.add(u)
+		}
+		if q.Where == nil || q.Where(u) {
+			res.found <- foundUser{i, u.Name, u.Email}
+		}
+	})
+}
+
+// RunParallel - Run по кускам файла в workers горутин. Вывод тот же, что у Run:
+// первый кусок выводится сразу, следующие - по порядку, когда до них дойдёт
+// очередь, номера строк сдвигаются на длину предыдущих
+func (q Query) RunParallel(r io.ReaderAt, size int64, workers int, out io.Writer) error {
+	if workers < 1 {
+		workers = 1
+	}
+	bounds, err := shardBounds(r, size, workers)
+	if err != nil {
+		return err
+	}
+
+	results := make([]*shardResult, len(bounds)-1)
+	for i := range results {
+		results[i] = q.newShard()
+		section := io.NewSectionReader(r, bounds[i], bounds[i+1]-bounds[i])
+		go q.runShard(section, results[i])
+	}
+
+	w := bufio.NewWriter(out)
+	fmt.Fprintln(w, "found users:")
+	offset := 0
+	for i, res := range results {
+		for f := range res.found {
+			formatUser(w, offset+f.line, f.name, f.email)
+		}
+		if res.err != nil {
+			// остальные куски дочитываются, чтобы их горутины не зависли
+			for _, rest := range results[i+1:] {
+				for range rest.found {
+				}
+			}
+			return fmt.Errorf("line %d: %w", offset+res.lines+1, res.err)
+		}
+		for k, agg := range q.Aggregates {
+			agg.merge(res.aggregates[k])
+		}
+		offset += res.lines
+	}
+
+	q.report(w)
+	return w.Flush()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSearchWorkers(t *testing.T) {
+	slowOut := new(bytes.Buffer)
+	SlowSearch(slowOut)
+
+	for _, workers := range []int{1, 2, 3, 7, 64} {
+		fastOut := new(bytes.Buffer)
+		fastSearch(fastOut, workers)
+		if fastOut.String() != slowOut.String() {
+			t.Errorf("%d workers: results not match\nGot:\n%v\nExpected:\n%v", workers, fastOut, slowOut)
+		}
+	}
+}
+
+func TestRunParallel(t *testing.T) {
+	// кусков больше, чем строк, и последняя строка с переводом строки
+	for _, data := range []string{queryUsers, queryUsers + "\n"} {
+		expected := new(bytes.Buffer)
+		query := func() Query {
+			return Query{
+				Where:      AnyBrowser(Contains("Chrome")),
+				Aggregates: []Aggregate{TopN("Top", 3, Browsers(AllOf()))},
+			}
+		}
+		if err := query().Run(strings.NewReader(data), expected); err != nil {
+			t.Fatal(err)
+		}
+
+		for workers := 1; workers <= 10; workers++ {
+			out := new(bytes.Buffer)
+			r := strings.NewReader(data)
+			if err := query().RunParallel(r, r.Size(), workers, out); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != expected.String() {
+				t.Errorf("%d workers: got\n%v\nexpected\n%v", workers, out, expected)
+			}
+		}
+	}
+
+	r := strings.NewReader("{}\n{}\n{\n{}")
+	err := Query{}.RunParallel(r, r.Size(), 4, new(bytes.Buffer))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// gatedReader не отдаёт вторую половину данных, пока не открыт gate
+type gatedReader struct {
+	*strings.Reader
+	half int64
+	gate chan struct{}
+}
+
+func (r gatedReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.half {
+		select {
+		case <-r.gate:
+		case <-time.After(5 * time.Second):
+			return 0, errors.New("second shard was read before the first one was written")
+		}
+	}
+	return r.Reader.ReadAt(p, off)
+}
+
+// signalWriter закрывает gate при первой записи
+type signalWriter struct {
+	bytes.Buffer
+	once sync.Once
+	gate chan struct{}
+}
+
+func (w *signalWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.gate) })
+	return w.Buffer.Write(p)
+}
+
+func TestRunParallelStreams(t *testing.T) {
+	line := `{"name":"Someone","email":"someone@example.com","browsers":["Chrome"]}` + "\n"
+	data := strings.Repeat(line, 1000)
+	gate := make(chan struct{})
+	r := gatedReader{strings.NewReader(data), int64(len(data) / 2), gate}
+	out := &signalWriter{gate: gate}
+
+	// первый кусок больше буфера вывода, поэтому попадает в out, пока второй ждёт
+	if err := (Query{}).RunParallel(r, r.Size(), 2, out); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out.String(), "\n"); n != 1000+2 {
+		t.Errorf("got %d lines of output", n)
+	}
+}
+
+func BenchmarkFastWorkers(b *testing.B) {
+	for _, workers := range []int{1, 2, 4, runtime.NumCPU()} {
+		b.Run(fmt.Sprint(workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				fastSearch(ioutil.Discard, workers)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+// Разбор User написан по образцу кода, который генерирует easyjson:
+// без рефлексии, неизвестные поля пропускаются без аллокаций
+
+import (
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxDepth - вложенность пропускаемых значений, как у encoding/json
+const maxDepth = 10000
+
+// jlexer - минимальный потоковый разбор JSON поверх одного буфера
+type jlexer struct {
+	data    []byte
+	pos     int
+	depth   int
+	err     error
+	scratch []byte // сюда раскрываются строки с escape-последовательностями
+}
+
+func (l *jlexer) ok() bool {
+	return l.err == nil
+}
+
+func (l *jlexer) fail(what string) {
+	if l.err != nil {
+		return
+	}
+	if l.pos >= len(l.data) {
+		l.err = fmt.Errorf("parse error: unexpected end of input, expected %s", what)
+		return
+	}
+	l.err = fmt.Errorf("parse error: unexpected %q at offset %d, expected %s", l.data[l.pos], l.pos, what)
+}
+
+func (l *jlexer) ws() {
+	for l.pos < len(l.data) {
+		switch l.data[l.pos] {
+		case ' ', '\t', '\r', '\n':
+			l.pos++
+		default:
+			return
+		}
+	}
+}
+
+// peek - следующий значащий символ, 0 в конце данных
+func (l *jlexer) peek() byte {
+	l.ws()
+	if l.pos >= len(l.data) {
+		return 0
+	}
+	return l.data[l.pos]
+}
+
+func (l *jlexer) isDelim(c byte) bool {
+	return l.ok() && l.peek() == c
+}
+
+func (l *jlexer) delim(c byte) {
+	if !l.ok() {
+		return
+	}
+	if l.peek() != c {
+		l.fail(string(c))
+		return
+	}
+	l.pos++
+}
+
+// comma пропускает запятую между элементами; false - запятой нет,
+// и дальше должна идти закрывающая скобка
+func (l *jlexer) comma() bool {
+	if l.isDelim(',') {
+		l.pos++
+		return true
+	}
+	return false
+}
+
+func hexValue(c byte) rune {
+	switch {
+	case c >= '0' && c <= '9':
+		return rune(c - '0')
+	case c >= 'a' && c <= 'f':
+		return rune(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return rune(c-'A') + 10
+	}
+	return -1
+}
+
+// hex4At - четыре шестнадцатеричные цифры с позиции pos
+func hex4At(data []byte, pos int) (rune, bool) {
+	if pos+4 > len(data) {
+		return 0, false
+	}
+	var r rune
+	for _, c := range data[pos : pos+4] {
+		v := hexValue(c)
+		if v < 0 {
+			return 0, false
+		}
+		r = r<<4 | v
+	}
+	return r, true
+}
+
+func (l *jlexer) hex4() rune {
+	r, ok := hex4At(l.data, l.pos)
+	if !ok {
+		l.fail("4 hex digits")
+		return 0
+	}
+	l.pos += 4
+	return r
+}
+
+// unescape раскрывает строку, начиная с первого '\' или битого UTF-8,
+// в l.scratch. Битые байты и одиночные суррогаты заменяются на U+FFFD,
+// как в encoding/json
+func (l *jlexer) unescape(start int) []byte {
+	buf := append(l.scratch[:0], l.data[start:l.pos]...)
+	var enc [utf8.UTFMax]byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			l.scratch = buf
+			return buf
+		case c < ' ':
+			l.fail("string character")
+			return nil
+		case c >= utf8.RuneSelf:
+			r, size := utf8.DecodeRune(l.data[l.pos:])
+			buf = append(buf, enc[:utf8.EncodeRune(enc[:], r)]...)
+			l.pos += size
+			continue
+		case c != '\\':
+			buf = append(buf, c)
+			l.pos++
+			continue
+		}
+
+		l.pos++
+		if l.pos >= len(l.data) {
+			break
+		}
+		esc := l.data[l.pos]
+		l.pos++
+		switch esc {
+		case '"', '\\', '/':
+			buf = append(buf, esc)
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'u':
+			r := l.hex4()
+			if utf16.IsSurrogate(r) {
+				// вторая половина пары забирается, только если пара правильная
+				low, ok := rune(0), false
+				if l.pos+1 < len(l.data) && l.data[l.pos] == '\\' && l.data[l.pos+1] == 'u' {
+					low, ok = hex4At(l.data, l.pos+2)
+				}
+				if r = utf16.DecodeRune(r, low); ok && r != utf8.RuneError {
+					l.pos += 6
+				}
+			}
+			buf = append(buf, enc[:utf8.EncodeRune(enc[:], r)]...)
+		default:
+			l.pos--
+			l.fail("escape sequence")
+			return nil
+		}
+	}
+	l.fail(`"`)
+	return nil
+}
+
+// stringBytes читает строку; результат действителен до следующего чтения
+func (l *jlexer) stringBytes() []byte {
+	l.delim('"')
+	if !l.ok() {
+		return nil
+	}
+	start := l.pos
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return l.data[start : l.pos-1]
+		case c == '\\':
+			return l.unescape(start)
+		case c < ' ':
+			l.fail("string character")
+			return nil
+		case c >= utf8.RuneSelf:
+			r, size := utf8.DecodeRune(l.data[l.pos:])
+			if r == utf8.RuneError && size == 1 {
+				return l.unescape(start)
+			}
+			l.pos += size
+			continue
+		}
+		l.pos++
+	}
+	l.fail(`"`)
+	return nil
+}
+
+func (l *jlexer) String() string {
+	return string(l.stringBytes())
+}
+
+// skip пропускает значение любого типа, проверяя его синтаксис
+func (l *jlexer) skip() {
+	switch c := l.peek(); {
+	case c == '"':
+		l.stringBytes()
+	case c == '{' || c == '[':
+		if l.depth++; l.depth > maxDepth {
+			l.fail("less nesting")
+			return
+		}
+		l.pos++
+		closing := byte(']')
+		if c == '{' {
+			closing = '}'
+		}
+		for more := !l.isDelim(closing); more && l.ok(); more = l.comma() {
+			if c == '{' {
+				l.stringBytes()
+				l.delim(':')
+			}
+			l.skip()
+		}
+		l.delim(closing)
+		l.depth--
+	case c == 't':
+		l.literal("true")
+	case c == 'f':
+		l.literal("false")
+	case c == 'n':
+		l.literal("null")
+	default:
+		l.number()
+	}
+}
+
+func (l *jlexer) literal(word string) {
+	if len(l.data)-l.pos < len(word) || string(l.data[l.pos:l.pos+len(word)]) != word {
+		l.fail(word)
+		return
+	}
+	l.pos += len(word)
+}
+
+// digits пропускает цифры и говорит, была ли хоть одна
+func (l *jlexer) digits() bool {
+	start := l.pos
+	for l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '9' {
+		l.pos++
+	}
+	return l.pos > start
+}
+
+// number пропускает число: -?(0|[1-9][0-9]*)(.[0-9]+)?([eE][+-]?[0-9]+)?
+func (l *jlexer) number() {
+	if l.pos < len(l.data) && l.data[l.pos] == '-' {
+		l.pos++
+	}
+	switch {
+	case l.pos < len(l.data) && l.data[l.pos] == '0':
+		l.pos++
+	case !l.digits():
+		l.fail("value")
+		return
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '.' {
+		l.pos++
+		if !l.digits() {
+			l.fail("digit")
+			return
+		}
+	}
+	if l.pos < len(l.data) && (l.data[l.pos] == 'e' || l.data[l.pos] == 'E') {
+		l.pos++
+		if l.pos < len(l.data) && (l.data[l.pos] == '+' || l.data[l.pos] == '-') {
+			l.pos++
+		}
+		if !l.digits() {
+			l.fail("digit")
+		}
+	}
+}
+
+// UnmarshalJSON заполняет Browsers, Email и Name, переиспользуя память Browsers
+func (u *User) UnmarshalJSON(data []byte) error {
+	l := jlexer{data: data}
+	u.unmarshalEasyJSON(&l)
+	if l.ok() && l.peek() != 0 {
+		l.fail("end of input")
+	}
+	return l.err
+}
+
+func (u *User) unmarshalEasyJSON(l *jlexer) {
+	l.delim('{')
+	for more := !l.isDelim('}'); more && l.ok(); more = l.comma() {
+		key := l.stringBytes()
+		l.delim(':')
+		switch string(key) {
+		case "browsers":
+			u.Browsers = l.stringSlice(u.Browsers[:0])
+		case "email":
+			u.Email = l.optString()
+		case "name":
+			u.Name = l.optString()
+		default:
+			l.skip()
+		}
+	}
+	l.delim('}')
+}
+
+// optString - строка или пустая строка для значения другого типа
+func (l *jlexer) optString() string {
+	if l.peek() != '"' {
+		l.skip()
+		return ""
+	}
+	return l.String()
+}
+
+// stringSlice дописывает в dst строки массива, прочие элементы пропускает
+func (l *jlexer) stringSlice(dst []string) []string {
+	if l.peek() != '[' {
+		l.skip()
+		return dst
+	}
+	l.delim('[')
+	for more := !l.isDelim(']'); more && l.ok(); more = l.comma() {
+		if l.peek() == '"' {
+			dst = append(dst, l.String())
+		} else {
+			l.skip()
+		}
+	}
+	l.delim(']')
+	return dst
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// stdUser - User без своего UnmarshalJSON, для сравнения с encoding/json
+type stdUser User
+
+func readLines(tb testing.TB) [][]byte {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return bytes.Split(data, []byte("\n"))
+}
+
+func TestUserUnmarshal(t *testing.T) {
+	lines := append(readLines(t),
+		[]byte(`{"name":"A\"b\\cé😀","extra":{"a":[1,{"b":"}"}],"c":null},"browsers":["x",1,null,"y"],"email":"a@b"}`),
+		[]byte(` { "browsers" : null , "name" : 5 , "email" : "e" } `),
+		// битый UTF-8 и одиночные суррогаты становятся U+FFFD
+		[]byte("{\"name\":\"a\xffb\\ud800\\u0041\\ud83d\\ude00\",\"email\":\"\xed\xa0\x80@x\",\"n\":-0.5e+3}"),
+	)
+
+	for _, line := range lines {
+		var got User
+		var expected stdUser
+		if err := got.UnmarshalJSON(line); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		// encoding/json не примет число в name и элементы не-строки в массиве
+		json.Unmarshal(line, &expected)
+		if got.Name != expected.Name || got.Email != expected.Email {
+			t.Errorf("%s: got %+v, expected %+v", line, got, expected)
+		}
+	}
+
+	var user User
+	user.UnmarshalJSON(lines[len(lines)-3])
+	if user.Name != "A\"b\\cé😀" || !reflect.DeepEqual(user.Browsers, []string{"x", "y"}) {
+		t.Errorf("unexpected user: %+v", user)
+	}
+
+	for _, bad := range []string{
+		``, `{`, `{"name":"a"`, `{"name" "a"}`, `{"name":"a\x"}`, `{} x`,
+		`{"name":"a" "email":"b"}`, `{"name":"a",}`, `{,"name":"a"}`,
+		`{"browsers":["x" "y"]}`, `{"browsers":["x",]}`, `{"x":["x" "y"]}`, `{"x":{"a" 1}}`,
+		`{"x":tru}`, `{"x":nul}`, `{"x":01}`, `{"x":-}`, `{"x":1.}`, `{"x":1e}`, `{"x":+1}`,
+		"{\"name\":\"a\tb\"}", "{\"x\":\"\x00\"}",
+	} {
+		if err := user.UnmarshalJSON([]byte(bad)); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestUserUnmarshalAllocs(t *testing.T) {
+	line := []byte(`{"company":"Flashpoint","phone":"176-88-49","tags":[1,2,{"a":"b"}]}`)
+	var user User
+	allocs := testing.AllocsPerRun(100, func() {
+		user.UnmarshalJSON(line)
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocations while skipping unknown fields", allocs)
+	}
+}
+
+func BenchmarkUnmarshalMap(b *testing.B) {
+	lines := readLines(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			user := map[string]interface{}{}
+			json.Unmarshal(line, &user)
+		}
+	}
+}
+
+func BenchmarkUnmarshalStruct(b *testing.B) {
+	lines := readLines(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			var user stdUser
+			json.Unmarshal(line, &user)
+		}
+	}
+}
+
+func BenchmarkUnmarshalEasy(b *testing.B) {
+	lines := readLines(b)
+	var user User
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			user.UnmarshalJSON(line)
+		}
+	}
+}